@@ -25,7 +25,7 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
 // SOFTWARE.
 
-// package auto runs gogp tool on GoPath when imported.
+// package auto runs gogp tool on GoPath(main module in module mode) when imported.
 //
 // usage:
 //   import (
@@ -35,13 +35,18 @@ package auto
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/gxlb/gogp"
 )
 
 func init() {
 	gogp.Silence(true)
-	if _, _, _, err := gogp.WorkOnGoPath(); err != nil { //runs gogp tool at GoPath when imported
+	r, err := gogp.WorkReport("") //runs gogp tool at GoPath(main module in module mode) when imported
+	if r != nil {
+		r.Render(os.Stdout, false)
+	}
+	if err != nil {
 		fmt.Println(err)
 	}
 }
@@ -0,0 +1,235 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gogp
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	dataDir   = ".gogp" //dir that gogp keeps its data in, it is excluded when walking
+	cacheName = "cache" //build cache file in dataDir
+)
+
+// build cache of a product
+type cacheEntry struct {
+	Key     string          `json:"key"`            //hash of inputs of product
+	Outputs []cacheOutput   `json:"outputs"`        //files saved or checked when rendering the product, in order
+	Once    map[string]bool `json:"once,omitempty"` //gp files processed when rendering, and if it is the first time to process it
+}
+
+// a file that rendered by a product
+type cacheOutput struct {
+	Path string `json:"path"`
+	Gp   string `json:"gp"`
+	Hash string `json:"hash"`
+}
+
+// buildCache maps inputs of products to hashes of files they render,
+// so unchanged products can be skipped without rendering.
+type buildCache struct {
+	Version string                 `json:"version"`
+	Entries map[string]*cacheEntry `json:"entries"` //product path => cache
+
+	lock  sync.Mutex //protect Entries in parallel mode
+	file  string     //path of cache file
+	root  string     //data root of cache, paths in keys are related to it
+	dirty bool       //cache has been changed
+}
+
+// get root dir of dir that gogp keeps its data in, which is root of module if dir is in a module
+func dataRoot(fsys FileSystem, dir string) string {
+	if mod := findUpFile(fsys, dir, goModFile); mod != "" {
+		return filepath.Dir(mod)
+	}
+	return dir
+}
+
+// load cache file, an empty cache is returned if it does not exist or is broken,
+// or it is made by another version of gogp
+func loadCache(fsys FileSystem, file string) *buildCache {
+	c := &buildCache{}
+	if b, err := fsys.ReadFile(file); err == nil {
+		if json.Unmarshal(b, c) != nil || c.Version != libVersion {
+			c = &buildCache{dirty: true}
+		}
+	}
+	if c.Entries == nil {
+		c.Entries = make(map[string]*cacheEntry)
+	}
+	c.Version, c.file, c.root = libVersion, file, filepath.Dir(filepath.Dir(file))
+	return c
+}
+
+// slash path of file related to data root of cache, so keys do not depend on where the root is
+func (c *buildCache) relate(file string) string {
+	return relatePath(c.root, file)
+}
+
+func (c *buildCache) get(product string) *cacheEntry {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.Entries[product]
+}
+
+// set cache of product, or delete it if e is nil
+func (c *buildCache) set(product string, e *cacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e == nil {
+		if _, ok := c.Entries[product]; !ok {
+			return
+		}
+		delete(c.Entries, product)
+	} else {
+		c.Entries[product] = e
+	}
+	c.dirty = true
+}
+
+// save cache file if it has been changed
+func (c *buildCache) save(fsys FileSystem) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	b, err := json.MarshalIndent(c, "", "\t")
+	if err == nil {
+		if err = fsys.WriteFile(c.file, append(b, '\n')); err == nil {
+			c.dirty = false
+		}
+	}
+	return err
+}
+
+// open build cache of dir for this run
+func (r *Runner) openCache(dir string) {
+	if r.NoCache || r.RemoveProductsOnly {
+		return
+	}
+	base := r.fileSystem()
+	r.cache = loadCache(base, filepath.ToSlash(filepath.Join(dataRoot(base, dir), dataDir, cacheName)))
+}
+
+// save build cache, products in memory are never cached
+func (r *Runner) closeCache() {
+	if r.cache != nil && !r.inMemory() {
+		if err := r.cache.save(r.fileSystem()); err != nil {
+			r.log(LevelWarn, "save cache failed", Field{"path", relateGoPath(r.fsys, r.cache.file)}, Field{"err", err})
+		}
+	}
+}
+
+// key of build cache of current section: config of gogp that is written into products,
+// path of gpg file, hashes of gp file and gpg section, and those of gp files and sections it requires.
+// Paths are related to data root, so a moved gpg or gp file changes the key.
+func (this *gopgProcessor) cacheKey(gpPath string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "version=%s tool=%s copyright=%s ext=%s\n", libVersion, filepath.ToSlash(filepath.Dir(thisFilePath)), contentHash(copyRightCode), this.runner.codeExt())
+	fmt.Fprintf(&b, "gpg=%s\n", this.runner.cache.relate(this.gpgPath))
+	this.writeCacheKey(&b, gpPath, this.section, 0, make(map[string]bool))
+	return contentHash(b.String())
+}
+
+func (this *gopgProcessor) writeCacheKey(b *strings.Builder, gpPath, section string, nDepth int, seen map[string]bool) {
+	id := gpPath + "|" + section
+	if seen[id] || nDepth >= 5 { //the same as limit of #GOGP_REQUIRE depth
+		return
+	}
+	seen[id] = true
+	content, err := this.rawLoadFile(gpPath)
+	if err != nil {
+		content = err.Error()
+	}
+	fmt.Fprintf(b, "gp=%s %s section=%s %s\n", this.runner.cache.relate(gpPath), contentHash(content), section, this.sectionHash(section))
+	for _, req := range this.requiredGpFiles(content, section) {
+		this.writeCacheKey(b, req.gp, req.section, nDepth+1, seen)
+	}
+}
+
+// skip rendering current section if cache of product is valid.
+// A valid cache has the same key, all files it rendered are not changed,
+// and every #GOGP_ONCE of gp files will be processed in the same way as it was rendered.
+func (this *gopgProcessor) skipByCache(gpPath, codePath, key string) bool {
+	e := this.runner.cache.get(codePath)
+	if e == nil || e.Key != key {
+		return false
+	}
+	for id, first := range e.Once {
+		if this.runner.checkOnce(id, false) == first {
+			return false
+		}
+	}
+	for _, out := range e.Outputs {
+		if content, err := this.rawLoadFile(out.Path); err != nil || contentHash(content) != out.Hash {
+			return false
+		}
+	}
+
+	ids := make([]string, 0, len(e.Once))
+	for id := range e.Once {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		this.runner.checkOnce(id, true)
+	}
+	for _, out := range e.Outputs {
+		if out.Path == codePath || this.runner.markSaved(out.Path) { //required products may be saved by other sections
+			this.record(StatusSkipped, out.Gp, out.Path)
+		}
+	}
+	return true
+}
+
+// save cache of product by files that rendered after report entry from
+func (this *gopgProcessor) saveCache(codePath, key string, from int) {
+	e := &cacheEntry{Key: key, Once: this.onceSeen}
+	for _, en := range this.report.Entries[from:] {
+		if en.Status == StatusFailed || en.Status == StatusRemoved {
+			this.runner.cache.set(codePath, nil)
+			return
+		}
+		if en.Target == "" {
+			continue
+		}
+		content, err := this.rawLoadFile(en.Target)
+		if err != nil {
+			this.runner.cache.set(codePath, nil)
+			return
+		}
+		e.Outputs = append(e.Outputs, cacheOutput{Path: en.Target, Gp: en.Gp, Hash: contentHash(content)})
+	}
+	this.runner.cache.set(codePath, e)
+}
@@ -0,0 +1,110 @@
+package gogp
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// countFS counts reads of every file
+type countFS struct {
+	*MemFileSystem
+	lock  sync.Mutex
+	reads map[string]int
+}
+
+func (c *countFS) ReadFile(name string) ([]byte, error) {
+	c.lock.Lock()
+	c.reads[name]++
+	c.lock.Unlock()
+	return c.MemFileSystem.ReadFile(name)
+}
+
+func TestBuildCache(t *testing.T) {
+	fsys := &countFS{MemFileSystem: NewMemFileSystem(map[string]string{
+		"/app/go.mod":       "module example.com/app\n",
+		"/app/demo/box.gp":  tstGpBox + "\n//#GOGP_ONCE\nconst boxOnce = 1\n//#GOGP_END_ONCE\n",
+		"/app/demo/box.gpg": tstGpgBox,
+	})}
+	products := []string{"/app/demo/box.gp_bool.go", "/app/demo/box.gp_int.go", "/app/demo/box.gp_string.go"}
+	work := func(cfg Config, written, skipped int) {
+		t.Helper()
+		cfg.Silence, cfg.FS = true, fsys
+		fsys.reads = make(map[string]int)
+		r, err := NewRunner(cfg).Work("/app")
+		if err == nil {
+			err = r.Err()
+		}
+		if err != nil || r.Count(StatusWritten) != written || r.Count(StatusSkipped) != skipped {
+			t.Fatalf("err=%v entries=%v", err, r.Entries)
+		}
+		n := 0
+		for _, f := range products {
+			if b, err := fsys.ReadFile(f); err == nil && strings.Contains(string(b), "const boxOnce = 1") {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Fatalf("#GOGP_ONCE code generated %d times", n)
+		}
+	}
+
+	work(Config{}, 2, 0)
+	if _, err := fsys.Stat("/app/.gogp/cache"); err != nil {
+		t.Fatalf("cache should be saved in module root: %v", err)
+	}
+
+	work(Config{}, 0, 2)
+	if n := fsys.reads["/app/demo/box.gp"]; n != 2 { //gp file is read only to make cache keys
+		t.Fatalf("products should be skipped without rendering, gp file is read %d times", n)
+	}
+
+	//a section changes, the others are still skipped
+	gpg := strings.Replace(tstGpgBox, "GLOBAL_NAME_PREFIX=String", "GLOBAL_NAME_PREFIX=Str", 1)
+	fsys.WriteFile("/app/demo/box.gpg", []byte(gpg))
+	work(Config{}, 1, 1)
+
+	//a new section processes #GOGP_ONCE first, so box_int can not be skipped
+	gpg = "[box_bool]\nGOGP_GpFilePath=box\nPACKAGE=package demo\nVALUE_TYPE=bool\nGLOBAL_NAME_PREFIX=Bool\n\n" + gpg
+	fsys.WriteFile("/app/demo/box.gpg", []byte(gpg))
+	work(Config{}, 2, 1)
+	work(Config{}, 0, 3)
+
+	//products changed by hand are restored
+	fsys.WriteFile("/app/demo/box.gp_int.go", []byte("package demo\n"))
+	work(Config{}, 1, 2)
+
+	//provenance of products changes with path of gpg file
+	fsys.WriteFile("/app/demo/box2.gpg", []byte(gpg))
+	fsys.Remove("/app/demo/box.gpg")
+	work(Config{}, 3, 0)
+	if b, _ := fsys.ReadFile("/app/demo/box.gp_int.go"); !strings.Contains(string(b), `gpg="box2.gpg"`) {
+		t.Fatalf("product should be generated from the renamed gpg file:\n%s", b)
+	}
+	work(Config{}, 0, 3)
+
+	//force update and no cache always render
+	work(Config{ForceUpdate: true}, 3, 0)
+	if n := fsys.reads["/app/demo/box.gp"]; n < 3 {
+		t.Fatalf("products should be rendered, gp file is read %d times", n)
+	}
+	fsys.Remove("/app/.gogp/cache")
+	work(Config{NoCache: true}, 0, 3)
+	if _, err := fsys.Stat("/app/.gogp/cache"); err == nil {
+		t.Fatal("cache should not be saved")
+	}
+}
+
+func TestBuildCacheInMemory(t *testing.T) {
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/demo/box.gp":  tstGpBox,
+		"/app/demo/box.gpg": tstGpgBox,
+	})
+	r, err := NewRunner(Config{Silence: true, FS: fsys, CheckOnly: true}).Work("/app")
+	if err != nil || len(r.Changes) != 2 {
+		t.Fatalf("err=%v changes=%v", err, r.Changes)
+	}
+	if _, err := fsys.Stat("/app/.gogp/cache"); err == nil {
+		t.Fatal("cache of products in memory should not be saved")
+	}
+}
@@ -0,0 +1,264 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gogp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ErrStale is returned by Check if some products are not up to date.
+var ErrStale = errors.New("products are out of date")
+
+// ChangeKind is kind of a file change.
+type ChangeKind int
+
+const (
+	ChangeCreate ChangeKind = iota + 1 //file will be created
+	ChangeModify                       //file will be changed
+	ChangeRemove                       //file will be removed
+)
+
+func (k ChangeKind) String() (s string) {
+	switch k {
+	case ChangeCreate:
+		s = "created"
+	case ChangeModify:
+		s = "changed"
+	case ChangeRemove:
+		s = "removed"
+	default:
+		s = "unknown"
+	}
+	return
+}
+
+// Change is a file change that a work process has made in memory.
+type Change struct {
+	Path string
+	Kind ChangeKind
+	Old  string //content on disk, empty if Kind is ChangeCreate
+	New  string //content in memory, empty if Kind is ChangeRemove
+
+	fsys FileSystem //file system of the run to relate paths, OS file system if it is nil
+}
+
+func (c *Change) String() string {
+	return fmt.Sprintf("%-8s %s", c.Kind, relateGoPath(c.fsys, c.Path))
+}
+
+// Diff returns unified diff of the change, paths are related to GoPath.
+func (c *Change) Diff() string {
+	name := filepath.ToSlash(relateGoPath(c.fsys, c.Path))
+	oldName, newName := name, name
+	switch c.Kind {
+	case ChangeCreate:
+		oldName = ""
+	case ChangeRemove:
+		newName = ""
+	}
+	return unifiedDiff(oldName, newName, c.Old, c.New)
+}
+
+// overlay is a FileSystem that holds file changes in memory instead of writing them to base
+type overlay struct {
+	base  FileSystem
+	lock  sync.Mutex
+	files map[string]*string //nil means the file has been removed
+}
+
+func newOverlay(base FileSystem) *overlay {
+	return &overlay{base: base, files: make(map[string]*string)}
+}
+
+// get file content in memory, ok is false if the file has not been changed
+func (o *overlay) get(file string) (content *string, ok bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	content, ok = o.files[filepath.Clean(file)]
+	return
+}
+
+func (o *overlay) ReadFile(file string) (b []byte, err error) {
+	content, ok := o.get(file)
+	if !ok {
+		return o.base.ReadFile(file)
+	}
+	if content == nil {
+		return nil, &os.PathError{Op: "open", Path: file, Err: os.ErrNotExist}
+	}
+	return []byte(*content), nil
+}
+
+func (o *overlay) WriteFile(file string, b []byte) error {
+	content := string(b)
+	o.lock.Lock()
+	o.files[filepath.Clean(file)] = &content
+	o.lock.Unlock()
+	return nil
+}
+
+func (o *overlay) Remove(file string) error {
+	if _, err := o.ReadFile(file); err != nil {
+		return &os.PathError{Op: "remove", Path: file, Err: os.ErrNotExist}
+	}
+	o.lock.Lock()
+	o.files[filepath.Clean(file)] = nil
+	o.lock.Unlock()
+	return nil
+}
+
+func (o *overlay) Stat(file string) (os.FileInfo, error) {
+	content, ok := o.get(file)
+	if !ok {
+		return o.base.Stat(file)
+	}
+	if content == nil {
+		return nil, &os.PathError{Op: "stat", Path: file, Err: os.ErrNotExist}
+	}
+	return &memFileInfo{name: filepath.Base(file), size: int64(len(*content))}, nil
+}
+
+// Walk walks base only, gogp never creates files it walks for, such as gpg files.
+func (o *overlay) Walk(root string, fn filepath.WalkFunc) error {
+	return o.base.Walk(root, fn)
+}
+
+// compare files in memory with base, and get changes sorted by path
+func (o *overlay) changes() (l []*Change) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	for file, content := range o.files {
+		old, err := o.base.ReadFile(file)
+		exist := err == nil
+		switch {
+		case content == nil:
+			if exist {
+				l = append(l, &Change{Path: file, Kind: ChangeRemove, Old: string(old), fsys: o})
+			}
+		case !exist:
+			l = append(l, &Change{Path: file, Kind: ChangeCreate, New: *content, fsys: o})
+		case string(old) != *content:
+			l = append(l, &Change{Path: file, Kind: ChangeModify, Old: string(old), New: *content, fsys: o})
+		}
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Path < l[j].Path })
+	return
+}
+
+// commit writes changes to base. If it fails halfway, changes that have been written are undone,
+// so base is left untouched, and path of the failed file is returned.
+func (o *overlay) commit() (path string, err error) {
+	changes := o.changes()
+	for i, c := range changes {
+		if err = c.apply(o.base, false); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				changes[j].apply(o.base, true)
+			}
+			return c.Path, err
+		}
+	}
+	return
+}
+
+// apply change to fsys, or undo it if undo is true
+func (c *Change) apply(fsys FileSystem, undo bool) error {
+	switch {
+	case c.Kind == ChangeCreate && undo, c.Kind == ChangeRemove && !undo:
+		return fsys.Remove(c.Path)
+	case undo:
+		return fsys.WriteFile(c.Path, []byte(c.Old))
+	}
+	return fsys.WriteFile(c.Path, []byte(c.New))
+}
+
+// get files written in memory sorted by path, whether they are changed or not
+func (o *overlay) written() (l []*Change) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for file, content := range o.files {
+		if content != nil {
+			l = append(l, &Change{Path: file, Kind: ChangeModify, New: *content, fsys: o})
+		}
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Path < l[j].Path })
+	return
+}
+
+// Check runs the whole work process in memory without writing anything,
+// and reports every product that would be created, changed or removed.
+// It returns ErrStale if any product is out of date.
+func (r *Runner) Check(dir string) (rpt *Report, err error) {
+	c := NewRunner(r.Config)
+	c.Config.CheckOnly = true
+	c.Config.ForceUpdate = false //products modified by hand are reported as errors rather than overwritten
+	if rpt, err = c.Work(dir); err == nil && len(rpt.Changes) > 0 {
+		err = fmt.Errorf("%w: %d file(s)", ErrStale, len(rpt.Changes))
+	}
+	return
+}
+
+// Lint runs the whole work process in memory without writing anything,
+// and returns the first error of gpg files, sections and products.
+// Products that are out of date are not treated as errors.
+func (r *Runner) Lint(dir string) (rpt *Report, err error) {
+	c := NewRunner(r.Config)
+	c.Config.CheckOnly = true
+	if rpt, err = c.Work(dir); err == nil {
+		rpt.InMemory, rpt.Changes = false, nil //do not care if products are up to date
+		err = rpt.Err()
+	}
+	return
+}
+
+// Render runs the whole work process in memory without writing anything,
+// and writes every file it produces to w, whether it is up to date or not.
+func (r *Runner) Render(dir string, w io.Writer) (rpt *Report, err error) {
+	c := NewRunner(r.Config)
+	c.Config.DryRun = true
+	c.renderAll = true //produce files that are up to date too, but refuse products modified by hand like a real run
+	if rpt, err = c.Work(dir); err == nil {
+		for _, f := range c.staged.written() {
+			fmt.Fprintf(w, "//==== %s ====\n%s", relateGoPath(c.fsys, f.Path), f.New)
+		}
+	}
+	return
+}
+
+// Check runs the whole work process in memory without writing anything,
+// and reports every product that would be created, changed or removed.
+// It returns ErrStale if any product is out of date.
+func Check(dir string) (*Report, error) {
+	return NewRunner(defaultConfig).Check(dir)
+}
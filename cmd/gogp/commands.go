@@ -0,0 +1,384 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gogp"
+
+	"github.com/vipally/cmdline"
+)
+
+// flags that a subcommand can use
+const (
+	flagForce = 1 << iota
+	flagJobs
+	flagExt
+	flagMore
+	flagDebug
+	flagDryRun
+	flagExclude
+	flagTransactional
+)
+
+const excludeUsage = "Pattern of paths to exclude in syntax of .gogpignore, it can be repeated. vendor, .git, testdata, node_modules and .gogp are excluded by default."
+
+const transactionalUsage = "Write products only if every gpg, section and product succeeds, otherwise roll back all changes."
+
+const logFormatUsage = "Format of log records and report, [text] or [json]. [text] is default. Every record of json is a line of JSON object."
+
+// options of subcommands
+type options struct {
+	filePath string
+	force    bool
+	jobs     int
+	codeExt  string
+	moreInfo bool
+	debug    bool
+	dryRun   bool
+	excludes excludeFlags
+	txn      bool
+	logFmt   string
+}
+
+// patterns of -exclude flags, the flag can be repeated
+type excludeFlags []string
+
+func (e *excludeFlags) String() string {
+	return strings.Join(*e, ",")
+}
+
+func (e *excludeFlags) Set(pattern string) error {
+	*e = append(*e, pattern)
+	return nil
+}
+
+func (o *options) config() gogp.Config {
+	return gogp.Config{
+		ForceUpdate: o.force,
+		Silence:     !o.moreInfo,
+		CodeExt:     o.codeExt,
+		Debug:       o.debug,
+		Jobs:        o.jobs,
+		DryRun:      o.dryRun,
+		Excludes:    o.excludes,
+
+		Transactional: o.txn,
+		Logger:        newLogger(o.logFmt, os.Stdout),
+	}
+}
+
+// make logger of format to w, format is "text" or "json"
+func newLogger(format string, w io.Writer) gogp.Logger {
+	if format == "json" {
+		return gogp.NewJSONLogger(w)
+	}
+	return gogp.NewTextLogger(w)
+}
+
+// check format of -log-format flag
+func checkLogFormat(format string) error {
+	switch format {
+	case "", "text", "json":
+		return nil
+	}
+	return fmt.Errorf("invalid log format [%s], it must be text or json", format)
+}
+
+// write report r to w in format
+func renderReport(r *gogp.Report, w io.Writer, format string, verbose bool) {
+	if format == "json" {
+		r.Log(newLogger(format, w), verbose)
+	} else {
+		r.Render(w, verbose)
+	}
+}
+
+// print error of a run in format
+func printError(err error, format string) {
+	if format == "json" {
+		newLogger(format, os.Stdout).Log(gogp.LevelError, err.Error())
+	} else {
+		fmt.Println(err)
+	}
+}
+
+// command is a subcommand of gogp tool
+type command struct {
+	name    string
+	summary string
+	flags   int                                    //flags that the command uses
+	run     func(o *options) (*gogp.Report, error) //run the command with options
+	runArgs func(args []string) error              //run the command with raw args if it is not nil
+	details string                                 //help of command that runs with raw args
+}
+
+var commands = []*command{
+	{
+		name:    "generate",
+		summary: "Generate code files from gp files, only the produce step is run.",
+		flags:   flagForce | flagJobs | flagExt | flagMore | flagDebug | flagExclude | flagDryRun | flagTransactional,
+		run:     runSteps(gogp.StepProduce),
+	},
+	{
+		name:    "reverse",
+		summary: "Rebuild gp files from fake go files by GOGP_REVERSE_xxx sections, only the reverse step is run.",
+		flags:   flagForce | flagJobs | flagExt | flagMore | flagDebug | flagExclude | flagDryRun | flagTransactional,
+		run:     runSteps(gogp.StepReverse),
+	},
+	{
+		name:    "require",
+		summary: "Expand #GOGP_REQUIRE in fake go files by GOGP_REVERSE_xxx sections, only the require step is run.",
+		flags:   flagForce | flagJobs | flagExt | flagMore | flagDebug | flagExclude | flagDryRun | flagTransactional,
+		run:     runSteps(gogp.StepRequire),
+	},
+	{
+		name:    "clean",
+		summary: "Remove all products.",
+		flags:   flagForce | flagJobs | flagExt | flagMore | flagDebug | flagExclude | flagDryRun | flagTransactional,
+		run: func(o *options) (*gogp.Report, error) {
+			cfg := o.config()
+			cfg.RemoveProductsOnly = true
+			return runWork(cfg, o)
+		},
+	},
+	{
+		name:    "prune",
+		summary: "Remove generated files that are no longer produced, like products of deleted or renamed sections.",
+		flags:   flagForce | flagJobs | flagExt | flagMore | flagDebug | flagExclude | flagDryRun | flagTransactional,
+		run: func(o *options) (*gogp.Report, error) {
+			r, err := gogp.NewRunner(o.config()).Prune(o.filePath)
+			if r != nil && o.dryRun {
+				r.RenderDiff(os.Stdout)
+			}
+			return r, err
+		},
+	},
+	{
+		name:    "check",
+		summary: "Check if products are up to date without writing anything, exit non-zero if not.",
+		flags:   flagJobs | flagExt | flagMore | flagDebug | flagExclude,
+		run: func(o *options) (*gogp.Report, error) {
+			return gogp.NewRunner(o.config()).Check(o.filePath)
+		},
+	},
+	{
+		name:    "render",
+		summary: "Print all files that gogp produces to stdout without writing anything.",
+		flags:   flagExt | flagMore | flagDebug | flagExclude,
+		run: func(o *options) (*gogp.Report, error) {
+			r, err := gogp.NewRunner(o.config()).Render(o.filePath, os.Stdout)
+			if err == nil {
+				err = r.Err()
+			}
+			if err != nil || o.moreInfo {
+				renderReport(r, os.Stderr, o.logFmt, o.moreInfo) //keep stdout clean for products
+			}
+			return nil, err
+		},
+	},
+	{
+		name:    "lint",
+		summary: "Report errors of gpg files, gp files and products without writing anything.",
+		flags:   flagJobs | flagExt | flagMore | flagDebug | flagExclude,
+		run: func(o *options) (*gogp.Report, error) {
+			return gogp.NewRunner(o.config()).Lint(o.filePath)
+		},
+	},
+	{
+		name:    "which",
+		summary: "Tell which gp file, gpg file and section a generated file comes from.",
+		runArgs: whichMain,
+		details: whichUsage,
+	},
+	{
+		name:    "gpg",
+		summary: "Manage sections and keys of a gpg file without editing it by hand.",
+		runArgs: gpgMain,
+		details: gpgUsage,
+	},
+}
+
+// find subcommand by name
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// get a run function of steps
+func runSteps(steps ...gogp.Step) func(o *options) (*gogp.Report, error) {
+	return func(o *options) (*gogp.Report, error) {
+		cfg := o.config()
+		cfg.Steps = steps
+		return runWork(cfg, o)
+	}
+}
+
+func runWork(cfg gogp.Config, o *options) (*gogp.Report, error) {
+	r, err := gogp.NewRunner(cfg).Work(o.filePath)
+	if r != nil && o.dryRun {
+		r.RenderDiff(os.Stdout)
+	}
+	return r, err
+}
+
+// run subcommand c with args, and get exit code
+func (c *command) exec(args []string) int {
+	if c.runArgs != nil {
+		if len(args) > 0 && isHelp(args[0]) {
+			c.usage(os.Stdout, nil)
+			return 0
+		}
+		if err := c.runArgs(args); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		return 0
+	}
+
+	o := &options{jobs: 1}
+	fs := cmdline.NewFlagSet("gogp "+c.name, cmdline.ContinueOnError)
+	c.setupFlags(fs, o)
+	fs.Usage = func() { c.usage(os.Stderr, fs) }
+	if err := fs.Parse(args); err != nil {
+		if err == cmdline.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if err := checkLogFormat(o.logFmt); err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	r, err := c.run(o)
+	if r != nil {
+		renderReport(r, os.Stdout, o.logFmt, o.moreInfo)
+		if err == nil {
+			err = r.Err()
+		}
+	}
+	if err != nil {
+		printError(err, o.logFmt)
+		return 1
+	}
+	return 0
+}
+
+func (c *command) setupFlags(fs *cmdline.FlagSet, o *options) {
+	if c.flags&flagForce != 0 {
+		fs.BoolVar(&o.force, "f", "force", o.force, false, "Force update all products, even if they are modified manually.")
+	}
+	if c.flags&flagExt != 0 {
+		fs.StringVar(&o.codeExt, "e", "Ext", o.codeExt, false, "Code file ext name. [.go] is default. [.gp] and [.gpg] is not allowed.")
+	}
+	if c.flags&flagJobs != 0 {
+		fs.IntVar(&o.jobs, "j", "jobs", o.jobs, false, "Number of gpg directories processed in parallel.")
+	}
+	if c.flags&flagMore != 0 {
+		fs.BoolVar(&o.moreInfo, "m", "more", o.moreInfo, false, "More information in working process.")
+	}
+	if c.flags&flagDebug != 0 {
+		fs.BoolVar(&o.debug, "d", "debug", o.debug, false, "Debug mode.")
+	}
+	if c.flags&flagDryRun != 0 {
+		fs.BoolVar(&o.dryRun, "dry-run", "dryRun", o.dryRun, false, "Print unified diffs of all products that would be changed without writing anything.")
+		fs.BoolVar(&o.dryRun, "diff", "dryRun", o.dryRun, false, "Print unified diffs of all products that would be changed without writing anything.")
+	}
+	if c.flags&flagTransactional != 0 {
+		fs.BoolVar(&o.txn, "transactional", "transactional", o.txn, false, transactionalUsage)
+	}
+	if c.flags&flagExclude != 0 {
+		fs.Var(&o.excludes, "exclude", "exclude", false, excludeUsage)
+	}
+	fs.StringVar(&o.logFmt, "log-format", "logFormat", o.logFmt, false, logFormatUsage)
+	fs.StringVar(&o.filePath, "", "filePath", o.filePath, false, "Path that gogp will work. GoPath(main module in module mode) is default. A gpg file or a section of it like <file.gpg>[:<section>] is allowed too.")
+}
+
+// print help of subcommand
+func (c *command) usage(w io.Writer, fs *cmdline.FlagSet) {
+	fmt.Fprintf(w, "Usage of gogp %s:\n  %s\n", c.name, c.summary)
+	if fs == nil {
+		fmt.Fprintf(w, "\n%s\n", c.details)
+		return
+	}
+	fmt.Fprintf(w, "\n  gogp %s", c.name)
+	var lines []string
+	fs.VisitAll(func(f *cmdline.Flag) {
+		if f.Visitor != f.Name { //synonyms show at the first one only
+			return
+		}
+		fmt.Fprintf(w, " [%s<%s>]", f.GetShowName(), f.LogicName)
+		lines = append(lines, fmt.Sprintf("  %s<%s>\n      %s", f.GetShowName(), f.LogicName, f.Usage))
+	})
+	fmt.Fprintf(w, "\n%s\n", strings.Join(lines, "\n"))
+}
+
+// get summary of all subcommands
+func commandsSummary() string {
+	var b strings.Builder
+	b.WriteString("subcommands, run \"gogp help <command>\" for details:\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "  %-9s %s\n", c.name, c.summary)
+	}
+	return b.String()
+}
+
+// run subcommand "gogp help"
+func helpMain(args []string) int {
+	if len(args) == 0 {
+		fmt.Print(commandsSummary())
+		return 0
+	}
+	c := lookupCommand(args[0])
+	if c == nil {
+		fmt.Printf("unknown subcommand %q\n%s", args[0], commandsSummary())
+		return 2
+	}
+	if c.runArgs != nil {
+		c.usage(os.Stdout, nil)
+		return 0
+	}
+	fs := cmdline.NewFlagSet("gogp "+c.name, cmdline.ContinueOnError)
+	c.setupFlags(fs, &options{jobs: 1})
+	c.usage(os.Stdout, fs)
+	return 0
+}
+
+func isHelp(s string) bool {
+	s = strings.TrimLeft(s, "-")
+	return s == "help" || s == "h" || s == "?"
+}
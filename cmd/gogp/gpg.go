@@ -0,0 +1,177 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gogp"
+	"gogp/ini"
+)
+
+const gpgUsage = `Usage of gogp gpg: manage sections and keys of a gpg file without editing it by hand.
+  gogp gpg list <gpgFile> [<section>]
+      List sections of gpg file, or keys of a section.
+  gogp gpg set <gpgFile> <section> <key=value>...
+      Set keys of a section, the section is added if it does not exist.
+      The gpg file is created if it does not exist.
+  gogp gpg copy <gpgFile> <section> <newSection> [<key=value>...]
+      Add a new section with keys of section, and set keys of the new section.
+  gogp gpg delete <gpgFile> <section> [<key>...]
+      Delete keys of a section, or the whole section if no key is given.
+  gogp gpg rename <gpgFile> <section> <newSection>
+      Rename a section.
+
+  Comments and order of sections and keys are kept.
+
+  usage samples:
+    gogp gpg set examples/example.gpg list_float VALUE_TYPE=float64
+    gogp gpg copy examples/example.gpg list_int list_float VALUE_TYPE=float64 GLOBAL_NAME_PREFIX=Float64`
+
+var errGpgUsage = errors.New(gpgUsage)
+
+// run subcommand "gogp gpg"
+func gpgMain(args []string) error {
+	if len(args) < 2 {
+		return errGpgUsage
+	}
+	cmd, file, args := args[0], args[1], args[2:]
+
+	fsys := gogp.OSFileSystem{} //gpg file is replaced atomically and its permissions are kept
+	var f *ini.IniFile
+	b, err := fsys.ReadFile(file)
+	if err == nil {
+		f, err = ini.Parse(file, bytes.NewReader(b))
+	}
+	if err != nil {
+		if !(os.IsNotExist(err) && cmd == "set") {
+			return err
+		}
+		f, _ = ini.Load(strings.NewReader(""))
+	}
+
+	switch cmd {
+	case "list":
+		return gpgList(f, args)
+	case "set":
+		if len(args) < 2 {
+			return errGpgUsage
+		}
+		err = gpgSet(f, args[0], args[1:])
+	case "copy":
+		if len(args) < 2 {
+			return errGpgUsage
+		}
+		err = gpgCopy(f, args[0], args[1], args[2:])
+	case "delete":
+		if len(args) < 1 {
+			return errGpgUsage
+		}
+		err = gpgDelete(f, args[0], args[1:])
+	case "rename":
+		if len(args) != 2 {
+			return errGpgUsage
+		}
+		err = f.RenameSection(args[0], args[1])
+	default:
+		return errGpgUsage
+	}
+	if err == nil {
+		err = f.Save(fsys, file)
+	}
+	return err
+}
+
+func gpgList(f *ini.IniFile, args []string) error {
+	switch len(args) {
+	case 0:
+		for _, sec := range f.Sections() {
+			fmt.Println(sec)
+		}
+	case 1:
+		keys := f.Keys(args[0])
+		if keys == nil {
+			return fmt.Errorf("section [%s] does not exist", args[0])
+		}
+		for _, key := range keys {
+			fmt.Printf("%s=%s\n", key, f.GetString(args[0], key, ""))
+		}
+	default:
+		return errGpgUsage
+	}
+	return nil
+}
+
+// set key=value pairs to section
+func gpgSet(f *ini.IniFile, sec string, pairs []string) error {
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid key-value %q, expect key=value", pair)
+		}
+		if err := f.SetString(sec, strings.TrimSpace(kv[0]), kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func gpgCopy(f *ini.IniFile, sec, newSec string, pairs []string) error {
+	keys := f.Keys(sec)
+	if keys == nil {
+		return fmt.Errorf("section [%s] does not exist", sec)
+	}
+	if err := f.AddSection(newSec); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := f.SetString(newSec, key, f.GetString(sec, key, "")); err != nil {
+			return err
+		}
+	}
+	return gpgSet(f, newSec, pairs)
+}
+
+func gpgDelete(f *ini.IniFile, sec string, keys []string) error {
+	if len(keys) == 0 {
+		if !f.RemoveSection(sec) {
+			return fmt.Errorf("section [%s] does not exist", sec)
+		}
+		return nil
+	}
+	for _, key := range keys {
+		if !f.DeleteKey(sec, key) {
+			return fmt.Errorf("key %s does not exist in section [%s]", key, sec)
+		}
+	}
+	return nil
+}
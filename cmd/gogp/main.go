@@ -29,6 +29,9 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"gogp"
 
 	"github.com/vipally/cmdline"
@@ -44,9 +47,24 @@ func main() {
 		moreInfo           = false
 		removeProductsOnly = false
 		debug              = false
+		jobs               = 1
+		check              = false
+		dryRun             = false
+		excludes           excludeFlags
+		transactional      = false
+		logFormat          = ""
 		exit_code          = 0
 	)
 
+	if len(os.Args) > 1 { //run subcommand
+		if os.Args[1] == "help" {
+			cmdline.Exit(helpMain(os.Args[2:]))
+		}
+		if c := lookupCommand(os.Args[1]); c != nil {
+			cmdline.Exit(c.exec(os.Args[2:]))
+		}
+	}
+
 	cmdline.Version(gogp.Version())
 	cmdline.CopyRight(cpright.CopyRight())
 
@@ -71,6 +89,10 @@ func main() {
 	2. GPG files(.gpg)
 	  GPG file is an ini-format file, that defines key-value replacing cases from 
 	source to the product.
+	  Lines lead with ";" or "#" are comments, values can be quoted as "..." with escapes
+	or '...' without escapes, and a line ends with "\" is continued at next line.
+	  Sections and keys are processed in order of declaration, duplicate sections or
+	keys and malformed lines are reported with file:line.
 	  "GOGP_IGNORE_xxx" style sections will be ignored by gogp tool.
 	  "GOGP_REVERSE_xxx" style sections are defined for reverse-mode to generate 
 	GP file from DummyGoFiles.
@@ -78,49 +100,138 @@ func main() {
 	  "GOGP_xxx" style keys are reserved by gogp tool which will never be replacing with.
 	  Corresponding GP file may with the same path and name.
 	  But we can redirect it by key "GOGP_GpFilePath".
+	  An import-path-like GOGP_GpFilePath(and #GOGP_REQUIRE path) is resolved by
+	go.mod module path, replace directives, go.work workspace and module cache,
+	then every entry of GOPATH.
 	  Key "GOGP_Name" is used to specify gp file name in reverse flow.
 	  And specify go-file-name-suffix in normal flow.
 
 	3. GP files(.gp)
 	  A go-like file, but exists some <xxx> style keys,
 	  that need to be replaced with which defined in GPG file.
+	  Malformed or unbalanced #GOGP_* directives are reported as gp-file:line:column with the start
+	of the enclosing block, and every <KEY> that has no replacing is reported with its line and column.
 
 	4. GO files(.go)
 	  gogp tool auto-generated GO files are exactly normal go code files.
-	  But never modify it manually, you can see this warning infomation at each file head.
-	  Auto work on GoPath is recmmended.
-	  gogp tool will deep travel the path to find all gpg files for processing.
-	  If the generated go code file's body has no changes, this file will not be updated.
+	  But never modify it manually, you can see this warning infomation at each file head,
+	which starts with the standard mark "// Code generated by gogp. DO NOT EDIT.".
+	  The file head has no time stamp but a fingerprint of inputs(hash of gp file, hash of
+	gpg section and version of gogp), so output is reproducible byte-for-byte.
+	  If the fingerprint and body of the generated go code file have no changes, this file will not be updated.
 	  So run gogp tool any times on GoPath is harmless, unless there are indeed changes.
-	  So any manually modification will be restored by this tool.
+	  The file head has a checksum of its body, a product modified manually is not overwritten or removed
+	unless -force is given, and the gpg file and section that it comes from are reported.
 	  Take care of that.
-	
+	  The file head has a parseable provenance line too, like // Provenance: src="list.gp" gpg="list.gpg" section="list_int",
+	paths are related to the generated file. "gogp which" and gogp.Provenance(path) read it.
+
+	5. Paths
+	  Auto work on GoPath is recmmended.
+	  In module mode, it works on the main module or go.work workspace of working path instead.
+	  gogp tool will deep travel the path to find all gpg files for processing.
+	  Paths like vendor, .git, testdata, node_modules and .gogp, paths matched by patterns
+	of .gogpignore files(syntax of .gitignore) in the path and its sub dirs, and paths matched
+	by -exclude are skipped.
+	  Go-style package patterns like ./... and github.com/x/y/... are allowed too.
+	  If the path is a gpg file, or a section of it like <file.gpg>:<section>, only this file or section
+	and GOGP_REVERSE sections that generate gp files it uses(or requires) are processed. These sections
+	are found in gpg files of the same root, or by the provenance of the gp files.
+
+	6. Subcommands, flags and modes
+	  Without subcommand, gogp runs every step on the path: require, reverse and produce.
+	A subcommand runs one step or one mode, and "gogp help <command>" shows its flags.
+	  -check(or "gogp check") reports products that are out of date without writing anything,
+	and exits non-zero if any. -dry-run(or -diff) prints unified diffs of them instead.
+	  -remove(or "gogp clean") removes all products. "gogp prune" removes generated files that are
+	no longer produced, like products of deleted or renamed sections.
+	  -transactional stages all outputs in memory, and writes them only if every gpg, section
+	and product succeeds, otherwise nothing is changed and the failure is reported.
+	  -jobs processes gpg directories in parallel.
+	  Messages are log records of levels(debug, info, warn, error) with fields like step, gpg, section, gp
+	and product. -log-format=json writes them and the report as lines of JSON objects, and Config.Logger
+	of gogp package takes them in embedding applications.
+
+	7. Data of gogp(.gogp)
+	  gogp keeps its data in .gogp of module root(or the working path).
+	  A build cache in .gogp/cache maps hashes of inputs of every product to hashes of files it
+	renders, so unchanged products are skipped without rendering.
+	  Concurrent runs on the same root are serialized by an advisory lock of .gogp/lock, and every
+	file is written atomically by a temp file and rename, permissions of existing files are kept.
+	  Every file gogp has written is recorded with its gpg file and section in .gogp/manifest.
+	"gogp prune" finds generated files by the manifest and the provenance of file head.
+	Products of excluded gpg files are kept, and nothing is pruned if any gpg, section or product fails.
+
 	usage samples:
 	  gogp
-	  gogp gopath`)
+	  gogp gopath
+	  gogp ./...
+	  gogp examples/example.gpg
+	  gogp examples/example.gpg:list_int
+	  gogp generate -diff ./...
+	  gogp prune
+
+	` + commandsSummary())
 
-	cmdline.StringVar(&filePath, "", "filePath", filePath, true, "Path that gogp will work. GoPath and WorkPath is allowed.")
+	cmdline.StringVar(&filePath, "", "filePath", filePath, true, "Path that gogp will work. GoPath and WorkPath is allowed. A gpg file or a section of it like <file.gpg>[:<section>] is allowed too.")
 	//	cmdline.BoolVar(&reverseWork, "r", "reverse", reverseWork, false,
 	//		`Reverse work, this mode is used to gen .gp file from a real-go file.
 	//		If set this flag, the filePath flag must be a .gpg file path related to GoPath.`)
-	cmdline.BoolVar(&forceUpdate, "f", "force", forceUpdate, false, "Force update all products.")
+	cmdline.BoolVar(&forceUpdate, "f", "force", forceUpdate, false, "Force update all products, even if they are modified manually.")
 	cmdline.StringVar(&codeExt, "e", "Ext", codeExt, false, "Code file ext name. [.go] is default. [.gp] and [.gpg] is not allowed.")
 	cmdline.BoolVar(&moreInfo, "m", "more", moreInfo, false, "More information in working process.")
 	cmdline.BoolVar(&debug, "d", "debug", debug, false, "Debug mode.")
 	cmdline.BoolVar(&removeProductsOnly, "remove", "remove", removeProductsOnly, false, "Only remove all products.")
+	cmdline.IntVar(&jobs, "j", "jobs", jobs, false, "Number of gpg directories processed in parallel.")
+	cmdline.BoolVar(&check, "check", "check", check, false, "Check if products are up to date without writing anything, exit non-zero if not.")
+	cmdline.BoolVar(&dryRun, "dry-run", "dryRun", dryRun, false, "Print unified diffs of all products that would be changed without writing anything.")
+	cmdline.BoolVar(&dryRun, "diff", "dryRun", dryRun, false, "Print unified diffs of all products that would be changed without writing anything.")
+	cmdline.Var(&excludes, "exclude", "exclude", false, excludeUsage)
+	cmdline.BoolVar(&transactional, "transactional", "transactional", transactional, false, transactionalUsage)
+	cmdline.StringVar(&logFormat, "log-format", "logFormat", logFormat, false, logFormatUsage)
 
 	// cmdline.AnotherName("ext", "e")
 	// cmdline.AnotherName("force", "f")
 	// cmdline.AnotherName("more", "m")
 	// cmdline.AnotherName("debug", "d")
 	cmdline.Parse()
+	if err := checkLogFormat(logFormat); err != nil {
+		fmt.Println(err)
+		cmdline.Exit(2)
+	}
 
-	gogp.RemoveProductsOnly(removeProductsOnly)
-	gogp.Silence(!moreInfo)
-	gogp.ForceUpdate(forceUpdate)
-	gogp.CodeExtName(codeExt)
-	gogp.Debug(debug)
-	gogp.Work(filePath)
+	runner := gogp.NewRunner(gogp.Config{
+		ForceUpdate:        forceUpdate,
+		Silence:            !moreInfo,
+		RemoveProductsOnly: removeProductsOnly,
+		CodeExt:            codeExt,
+		Debug:              debug,
+		Jobs:               jobs,
+		DryRun:             dryRun,
+		Excludes:           excludes,
+		Transactional:      transactional,
+		Logger:             newLogger(logFormat, os.Stdout),
+	})
+	var r *gogp.Report
+	var err error
+	if check {
+		r, err = runner.Check(filePath)
+	} else {
+		r, err = runner.Work(filePath)
+	}
+	if r != nil {
+		if dryRun {
+			r.RenderDiff(os.Stdout)
+		}
+		renderReport(r, os.Stdout, logFormat, moreInfo)
+		if err == nil {
+			err = r.Err()
+		}
+	}
+	if err != nil {
+		printError(err, logFormat)
+		exit_code = 1
+	}
 
 	cmdline.Exit(exit_code)
 }
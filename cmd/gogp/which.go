@@ -0,0 +1,93 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"gogp"
+)
+
+const whichUsage = `Usage of gogp which: tell which gp file, gpg file and section a generated file comes from.
+  gogp which [-open] <file>
+      Print source file(gp file of a product, or fake go file of a gp file), gpg file,
+      section and key values of the section.
+  -open
+      Print lines of source file that match lines of the generated file too.
+
+  usage samples:
+    gogp which examples/example2/list.gp_#personcc4f.go
+    gogp which -open examples/example2/list.gp_#personcc4f.go`
+
+var errWhichUsage = errors.New(whichUsage)
+
+// run subcommand "gogp which"
+func whichMain(args []string) error {
+	var file string
+	open := false
+	for _, arg := range args {
+		switch arg {
+		case "-open", "--open":
+			open = true
+		default:
+			if file != "" {
+				return errWhichUsage
+			}
+			file = arg
+		}
+	}
+	if file == "" {
+		return errWhichUsage
+	}
+
+	r := gogp.NewRunner(gogp.Config{})
+	info, err := r.Provenance(file)
+	if info == nil {
+		return err
+	}
+	fmt.Printf("file:    %s\nsource:  %s\ngpg:     %s\nsection: %s\n", info.File, info.Source, info.Gpg, info.Section)
+	if err != nil {
+		return err
+	}
+	fmt.Println("keys:")
+	for _, kv := range info.Keys {
+		fmt.Printf("  %s=%s\n", kv.Key, kv.Value)
+	}
+	if open {
+		lines, err := r.SourceLines(info)
+		if err != nil {
+			return err
+		}
+		fmt.Println("lines:")
+		for _, l := range lines {
+			fmt.Printf("%s:%d: %s\n", info.Source, l.Line, l.Text)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gogp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// condition of #GOGP_IFDEF, #GOGP_ELIF and #GOGP_CASE
+//
+//	or      = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | primary
+//	primary = "(" or ")" | operand [ ( "==" | "!=" ) operand ]
+//	operand = name | string
+//
+// A name is made of letters, digits, "_", "<", ">" and ".", like <KEY>, int or time.Duration.
+// A string is a quoted literal with escapes of go, like "*Person" or "map[string]int".
+// eg: <KEY_TYPE> && !(VALUE_TYPE == int || VALUE_TYPE == "*Person")
+// Condition ends at "//", text after it is a comment.
+type condNode struct {
+	op     string    //"||", "&&", "!", "==", "!=", or empty for an operand
+	value  string    //name or unquoted string of an operand
+	quoted bool      //operand is a string, which is a value but never a key
+	x, y   *condNode //operands of op
+}
+
+// name of an operand, <key> -> key, a string is kept
+func (c *condNode) name() string {
+	if s := len(c.value); !c.quoted && s >= 2 && c.value[0] == '<' && c.value[s-1] == '>' {
+		return c.value[1 : s-1]
+	}
+	return c.value
+}
+
+// token of condition
+type condToken struct {
+	text   string     //operator, name, or unquoted string
+	src    string     //source text of token, it is empty at the end of condition
+	quoted bool       //token is a string
+	pos    int        //byte offset in condition
+	err    *condError //why text from pos can not be split into tokens, only the end token has it
+}
+
+func (t condToken) is(op string) bool {
+	return !t.quoted && t.src != "" && t.text == op
+}
+
+func (t condToken) isEnd() bool {
+	return t.src == ""
+}
+
+func (t condToken) isOperand() bool {
+	return t.quoted || t.src != "" && isCondWordChar(t.text[0])
+}
+
+// error of condition at byte offset pos
+type condError struct {
+	pos int
+	msg string
+}
+
+func (e *condError) Error() string {
+	return e.msg
+}
+
+var condOperators = []string{"&&", "||", "==", "!=", "!", "(", ")"}
+
+// split condition into tokens, condition ends at "//".
+// It stops at text that is not a token, the end token carries the error of that text.
+func lexCondition(s string) (toks []condToken) {
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+			continue
+		case strings.HasPrefix(s[i:], "//"):
+			return append(toks, condToken{pos: i})
+		case isCondWordChar(c):
+			j := i + 1
+			for j < len(s) && isCondWordChar(s[j]) {
+				j++
+			}
+			toks = append(toks, condToken{text: s[i:j], src: s[i:j], pos: i})
+			i = j
+			continue
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' && s[j] != '\n' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) || s[j] != '"' {
+				return append(toks, condToken{pos: i, err: &condError{pos: i, msg: "string is not terminated"}})
+			}
+			v, e := strconv.Unquote(s[i : j+1])
+			if e != nil {
+				return append(toks, condToken{pos: i, err: &condError{pos: i, msg: fmt.Sprintf("invalid string %s", s[i:j+1])}})
+			}
+			toks = append(toks, condToken{text: v, src: s[i : j+1], quoted: true, pos: i})
+			i = j + 1
+			continue
+		}
+
+		op := ""
+		for _, v := range condOperators {
+			if strings.HasPrefix(s[i:], v) {
+				op = v
+				break
+			}
+		}
+		if op == "" {
+			msg := fmt.Sprintf("unexpected %q", c)
+			if v := condUnquotedValue(s, i); v != "" {
+				msg += fmt.Sprintf(", quote the value like %s", strconv.Quote(v))
+			}
+			return append(toks, condToken{pos: i, err: &condError{pos: i, msg: msg}})
+		}
+		toks = append(toks, condToken{text: op, src: op, pos: i})
+		i += len(op)
+	}
+	return append(toks, condToken{pos: i})
+}
+
+// value around s[i] that looks like a type, eg: map[string]int or *Person, it must be quoted in condition.
+// It returns "" if s[i] is a broken operator like "&".
+func condUnquotedValue(s string, i int) string {
+	if strings.IndexByte("&|=", s[i]) >= 0 {
+		return ""
+	}
+	begin, end := i, i
+	for begin > 0 && isCondWordChar(s[begin-1]) {
+		begin--
+	}
+	for end < len(s) && s[end] != ' ' && s[end] != '\t' && s[end] != '\r' && s[end] != '\n' && !strings.HasPrefix(s[end:], "//") {
+		end++
+	}
+	v := s[begin:end]
+	for strings.HasSuffix(v, ")") && strings.Count(v, ")") > strings.Count(v, "(") { //closes a group of condition
+		v = v[:len(v)-1]
+	}
+	for j := 0; j < len(v); j++ {
+		if isCondWordChar(v[j]) {
+			return v
+		}
+	}
+	return ""
+}
+
+func isCondWordChar(c byte) bool {
+	return c == '_' || c == '<' || c == '>' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// parse condition, it returns nil if condition is empty.
+// Text after a complete condition is an error at the first offending token unless it starts with "//".
+func parseCondition(s string) (*condNode, *condError) {
+	p := &condParser{toks: lexCondition(s)}
+	if tok := p.peek(); tok.isEnd() {
+		return nil, tok.err
+	}
+	c, err := p.parseOr()
+	if err == nil && !p.atEnd() {
+		err = p.unexpected(`"&&", "||" or "//"`)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parse key of #GOGP_SWITCH, which is a single operand, it returns "" if key is empty
+func parseCondKey(s string) (string, *condError) {
+	p := &condParser{toks: lexCondition(s)}
+	if tok := p.peek(); tok.isEnd() {
+		return "", tok.err
+	}
+	c, err := p.parseOperand()
+	if err == nil && !p.atEnd() {
+		err = p.unexpected(`"//"`)
+	}
+	if err != nil {
+		return "", err
+	}
+	return c.name(), nil
+}
+
+// recursive descent parser of condition tokens
+type condParser struct {
+	toks []condToken
+	i    int
+}
+
+func (p *condParser) peek() condToken {
+	return p.toks[p.i]
+}
+
+// all tokens are parsed and the rest of condition is a comment or nothing
+func (p *condParser) atEnd() bool {
+	tok := p.peek()
+	return tok.isEnd() && tok.err == nil
+}
+
+func (p *condParser) next() condToken {
+	tok := p.toks[p.i]
+	if !tok.isEnd() {
+		p.i++
+	}
+	return tok
+}
+
+// error of the current token, expect tells what is expected
+func (p *condParser) unexpected(expect string) *condError {
+	tok := p.peek()
+	if tok.err != nil {
+		return tok.err
+	}
+	msg := "unexpected end of condition"
+	if !tok.isEnd() {
+		msg = fmt.Sprintf("unexpected %q", tok.src)
+	}
+	if expect != "" {
+		msg += ", expect " + expect
+	}
+	return &condError{pos: tok.pos, msg: msg}
+}
+
+func (p *condParser) parseOr() (x *condNode, err *condError) {
+	return p.parseBinary("||", p.parseAnd)
+}
+
+func (p *condParser) parseAnd() (x *condNode, err *condError) {
+	return p.parseBinary("&&", p.parseUnary)
+}
+
+// parse operands joined by op
+func (p *condParser) parseBinary(op string, operand func() (*condNode, *condError)) (x *condNode, err *condError) {
+	if x, err = operand(); err != nil {
+		return
+	}
+	for p.peek().is(op) {
+		p.next()
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		x = &condNode{op: op, x: x, y: y}
+	}
+	return
+}
+
+func (p *condParser) parseUnary() (*condNode, *condError) {
+	if !p.peek().is("!") {
+		return p.parsePrimary()
+	}
+	p.next()
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &condNode{op: "!", x: x}, nil
+}
+
+func (p *condParser) parsePrimary() (*condNode, *condError) {
+	if p.peek().is("(") {
+		p.next()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek().is(")") {
+			return nil, p.unexpected(`")"`)
+		}
+		p.next()
+		return x, nil
+	}
+
+	x, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if op := p.peek(); op.is("==") || op.is("!=") {
+		p.next()
+		y, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		x = &condNode{op: op.text, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *condParser) parseOperand() (*condNode, *condError) {
+	tok := p.peek()
+	if !tok.isOperand() {
+		return nil, p.unexpected("a key or value")
+	}
+	p.next()
+	return &condNode{value: tok.text, quoted: tok.quoted}, nil
+}
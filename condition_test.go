@@ -0,0 +1,114 @@
+package gogp
+
+import (
+	"strconv"
+	"testing"
+)
+
+// testCondString shows condition in prefix notation
+func testCondString(c *condNode) string {
+	switch c.op {
+	case "":
+		if c.quoted {
+			return strconv.Quote(c.value)
+		}
+		return c.value
+	case "!":
+		return "(! " + testCondString(c.x) + ")"
+	}
+	return "(" + c.op + " " + testCondString(c.x) + " " + testCondString(c.y) + ")"
+}
+
+func TestParseCondition(t *testing.T) {
+	cases := []struct {
+		cond, want string
+	}{
+		{"<KEY>", "<KEY>"},
+		{" ! <key> || <key>==xxx || <key> != xxx //comment", "(|| (|| (! <key>) (== <key> xxx)) (!= <key> xxx))"},
+		{"A && !B || C && D", "(|| (&& A (! B)) (&& C D))"},
+		{"<KEY_TYPE> && !(VALUE_TYPE == int || VALUE_TYPE == string)", "(&& <KEY_TYPE> (! (|| (== VALUE_TYPE int) (== VALUE_TYPE string))))"},
+		{"!!(A)", "(! (! A))"},
+		{`VALUE_TYPE == "*Person" || VALUE_TYPE=="map[string]int"`, `(|| (== VALUE_TYPE "*Person") (== VALUE_TYPE "map[string]int"))`},
+		{`KEY_TYPE != time.Duration && "a \"||\" b\t//"`, `(&& (!= KEY_TYPE time.Duration) "a \"||\" b\t//")`},
+		{"", ""},
+		{"  // comment", ""},
+	}
+	for _, c := range cases {
+		got, err := parseCondition(c.cond)
+		if err != nil || (got == nil) != (c.want == "") || got != nil && testCondString(got) != c.want {
+			t.Errorf("%q: got %v, err %v, want %q", c.cond, got, err, c.want)
+		}
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	cases := []struct {
+		cond string
+		pos  int
+		msg  string
+	}{
+		{"A &&", 4, "unexpected end of condition, expect a key or value"},
+		{"(A || B", 7, `unexpected end of condition, expect ")"`},
+		{"A == (B)", 5, `unexpected "(", expect a key or value`},
+		{"A || == B", 5, `unexpected "==", expect a key or value`},
+		{`A == "x`, 5, "string is not terminated"},
+		{`A == "\q"`, 5, `invalid string "\q"`},
+		{"!", 1, "unexpected end of condition, expect a key or value"},
+		{"A || &B", 5, "unexpected '&'"},
+		{"A == map[string]int", 8, `unexpected '[', quote the value like "map[string]int"`},
+		{"A == *Person || B", 5, `unexpected '*', quote the value like "*Person"`},
+		{"!(A == []int) //comment", 7, `unexpected '[', quote the value like "[]int"`},
+		{"A == map[K]V//comment", 8, `unexpected '[', quote the value like "map[K]V"`},
+	}
+	for _, c := range cases {
+		_, err := parseCondition(c.cond)
+		if err == nil || err.pos != c.pos || err.msg != c.msg {
+			t.Errorf("%q: got %v, want %d:%s", c.cond, err, c.pos, c.msg)
+		}
+	}
+}
+
+func TestParseConditionTail(t *testing.T) {
+	cases := []struct {
+		cond string
+		pos  int
+		msg  string
+	}{
+		{"A B", 2, `unexpected "B", expect "&&", "||" or "//"`},
+		{"A & B", 2, "unexpected '&'"},
+		{"(A))", 3, `unexpected ")", expect "&&", "||" or "//"`},
+		{"KIND some comment of old style", 5, `unexpected "some", expect "&&", "||" or "//"`},
+		{`A == "x" "y"`, 9, `unexpected "\"y\"", expect "&&", "||" or "//"`},
+		{`A != B "not terminated`, 7, "string is not terminated"},
+		{"A == func()", 9, `unexpected "(", expect "&&", "||" or "//"`},
+		{"A || B) //comment", 6, `unexpected ")", expect "&&", "||" or "//"`},
+	}
+	for _, c := range cases {
+		got, err := parseCondition(c.cond)
+		if got != nil || err == nil || err.pos != c.pos || err.msg != c.msg {
+			t.Errorf("%q: got %v, err %v, want %d:%s", c.cond, got, err, c.pos, c.msg)
+		}
+	}
+}
+
+func TestParseCondKey(t *testing.T) {
+	cases := []struct {
+		key, want string
+		pos       int
+	}{
+		{"", "", -1},
+		{" <VALUE_TYPE> //comment", "VALUE_TYPE", -1},
+		{"pkg.KEY", "pkg.KEY", -1},
+		{`"<VALUE_TYPE>"`, "<VALUE_TYPE>", -1},
+		{"A B", "", 2},
+		{"A == B", "", 2},
+		{"!A", "", 0},
+		{"*Person", "", 0},
+	}
+	for _, c := range cases {
+		got, err := parseCondKey(c.key)
+		if got != c.want || (err == nil) != (c.pos < 0) || err != nil && err.pos != c.pos {
+			t.Errorf("%q: got %q, err %v", c.key, got, err)
+		}
+	}
+}
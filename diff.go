@@ -0,0 +1,248 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gogp
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	diffContextLines = 3    //number of context lines around changes
+	diffMaxEdits     = 4000 //give up finding shortest edits if more than this
+)
+
+// an edit of line diff
+type diffEdit struct {
+	op   byte //' ' keep, '-' delete, '+' insert
+	line string
+}
+
+// split text to lines, every line keeps its "\n" except the last one without it
+func splitDiffLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// get edits from a to b by Myers' shortest edit script algorithm
+func diffLines(a, b []string) (edits []diffEdit) {
+	//trim common prefix and suffix, which is the most case of gogp products
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	for _, l := range a[:pre] {
+		edits = append(edits, diffEdit{' ', l})
+	}
+	edits = append(edits, myersDiff(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, l := range a[len(a)-suf:] {
+		edits = append(edits, diffEdit{' ', l})
+	}
+	return
+}
+
+func myersDiff(a, b []string) []diffEdit {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > diffMaxEdits {
+		max = diffMaxEdits
+	}
+
+	//trace[d] is the furthest x of every diagonal k in [-d, d] after d edits
+	var trace [][]int
+	get := func(v []int, d, k int) int { return v[k+d] }
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		v := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+			x := 0
+			switch {
+			case d == 0:
+			case k == -d || (k != d && get(trace[d-1], d-1, k-1) < get(trace[d-1], d-1, k+1)):
+				x = get(trace[d-1], d-1, k+1) //insert
+			default:
+				x = get(trace[d-1], d-1, k-1) + 1 //delete
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[k+d] = x
+			if x >= n && y >= m {
+				found = true
+			}
+		}
+		trace = append(trace, v)
+	}
+
+	if !found { //too many edits, replace all lines
+		edits := make([]diffEdit, 0, n+m)
+		for _, l := range a {
+			edits = append(edits, diffEdit{'-', l})
+		}
+		for _, l := range b {
+			edits = append(edits, diffEdit{'+', l})
+		}
+		return edits
+	}
+
+	//backtrack from the end
+	var rev []diffEdit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && get(trace[d-1], d-1, k-1) < get(trace[d-1], d-1, k+1)) {
+			prevK = k + 1
+		}
+		prevX := get(trace[d-1], d-1, prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			rev = append(rev, diffEdit{' ', a[x-1]})
+			x, y = x-1, y-1
+		}
+		if x == prevX {
+			rev = append(rev, diffEdit{'+', b[y-1]})
+		} else {
+			rev = append(rev, diffEdit{'-', a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		rev = append(rev, diffEdit{' ', a[x-1]})
+		x, y = x-1, y-1
+	}
+
+	edits := make([]diffEdit, len(rev))
+	for i, e := range rev {
+		edits[len(rev)-1-i] = e
+	}
+	return edits
+}
+
+// unifiedDiff returns unified diff of text from oldText to newText.
+// Empty oldName or newName means the file does not exist.
+func unifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText && oldName != "" && newName != "" {
+		return ""
+	}
+	a := splitDiffLines(oldText)
+	b := splitDiffLines(newText)
+	edits := diffLines(a, b)
+
+	var sb strings.Builder
+	if oldName == "" {
+		oldName = "/dev/null"
+	} else {
+		oldName = "a/" + strings.TrimPrefix(oldName, "/")
+	}
+	if newName == "" {
+		newName = "/dev/null"
+	} else {
+		newName = "b/" + strings.TrimPrefix(newName, "/")
+	}
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	//write a line, and mark the last line of file that has no "\n"
+	writeLine := func(e diffEdit) {
+		sb.WriteByte(e.op)
+		sb.WriteString(e.line)
+		if !strings.HasSuffix(e.line, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+
+	for i := 0; i < len(edits); {
+		//find next change
+		for i < len(edits) && edits[i].op == ' ' {
+			i++
+		}
+		if i >= len(edits) {
+			break
+		}
+		start := i - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		//extend hunk until diffContextLines*2 unchanged lines
+		end, keep := i, 0
+		for end < len(edits) && keep <= 2*diffContextLines {
+			if edits[end].op == ' ' {
+				keep++
+			} else {
+				keep = 0
+			}
+			end++
+		}
+		if keep > diffContextLines {
+			end -= keep - diffContextLines
+		}
+
+		//line numbers of hunk head
+		aStart, bStart := 1, 1
+		for _, e := range edits[:start] {
+			if e.op != '+' {
+				aStart++
+			}
+			if e.op != '-' {
+				bStart++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				aCount++
+			}
+			if e.op != '-' {
+				bCount++
+			}
+		}
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		for _, e := range edits[start:end] {
+			writeLine(e)
+		}
+		i = end
+	}
+	return sb.String()
+}
@@ -0,0 +1,30 @@
+package gogp
+
+import (
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	cases := []struct {
+		oldName, newName string
+		old, new         string
+		want             string
+	}{
+		{"a.go", "a.go", "x\ny\n", "x\ny\n", ""},
+		{"", "a.go", "", "x\ny\n", "--- /dev/null\n+++ b/a.go\n@@ -0,0 +1,2 @@\n+x\n+y\n"},
+		{"a.go", "", "x\n", "", "--- a/a.go\n+++ /dev/null\n@@ -1,1 +0,0 @@\n-x\n"},
+		{"a.go", "a.go", "1\n2\n3\n4\n5\n6\n7\n8\n9\n", "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			"--- a/a.go\n+++ b/a.go\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n"},
+		{"a.go", "a.go", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			"--- a/a.go\n+++ b/a.go\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n"},
+		{"a.go", "a.go", "x\ny", "x\nz\n",
+			"--- a/a.go\n+++ b/a.go\n@@ -1,2 +1,2 @@\n x\n-y\n\\ No newline at end of file\n+z\n"},
+		{"a.go", "a.go", "a\nb\nc\n", "b\nc\nd\n",
+			"--- a/a.go\n+++ b/a.go\n@@ -1,3 +1,3 @@\n-a\n b\n c\n+d\n"},
+	}
+	for i, c := range cases {
+		if got := unifiedDiff(c.oldName, c.newName, c.old, c.new); got != c.want {
+			t.Errorf("case %d: got\n%s\nwant\n%s", i, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gogp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// kind of gp file tokens
+type tokenKind int
+
+const (
+	tokText      tokenKind = iota //plain text, or a directive that is not a block, eg: #GOGP_REQUIRE
+	tokIf                         //#GOGP_IFDEF, #GOGP_IFDEF2
+	tokElif                       //#GOGP_ELIF, #GOGP_ELIF2
+	tokElse                       //#GOGP_ELSE, #GOGP_ELSE2
+	tokEndIf                      //#GOGP_ENDIF, #GOGP_ENDIF2
+	tokSwitch                     //#GOGP_SWITCH, #GOGP_MULTISWITCH
+	tokCase                       //#GOGP_CASE
+	tokDefault                    //#GOGP_DEFAULT
+	tokEndCase                    //#GOGP_ENDCASE
+	tokEndSwitch                  //#GOGP_ENDSWITCH, #GOGP_ENDMULTISWITCH
+	tokOnce                       //#GOGP_ONCE
+	tokEndOnce                    //#GOGP_END_ONCE
+	tokIgnore                     //#GOGP_IGNORE_BEGIN ... #GOGP_IGNORE_END, #GOGP_GPONLY_BEGIN ... #GOGP_GPONLY_END
+	tokMap                        //#GOGP_MAP(<src>, <dst>)
+	tokInvalid                    //malformed or unknown directive
+	tokEOF                        //end of file
+)
+
+// block directives and their kinds, other #GOGP_* directives are kept as text
+var directiveKinds = map[string]tokenKind{
+	"IFDEF":          tokIf,
+	"IFDEF2":         tokIf,
+	"ELIF":           tokElif,
+	"ELIF2":          tokElif,
+	"ELSE":           tokElse,
+	"ELSE2":          tokElse,
+	"ENDIF":          tokEndIf,
+	"ENDIF2":         tokEndIf,
+	"SWITCH":         tokSwitch,
+	"MULTISWITCH":    tokSwitch,
+	"CASE":           tokCase,
+	"DEFAULT":        tokDefault,
+	"ENDCASE":        tokEndCase,
+	"ENDSWITCH":      tokEndSwitch,
+	"ENDMULTISWITCH": tokEndSwitch,
+	"ONCE":           tokOnce,
+	"END_ONCE":       tokEndOnce,
+	"IGNORE_BEGIN":   tokIgnore,
+	"GPONLY_BEGIN":   tokIgnore,
+	"MAP":            tokMap,
+}
+
+// directives that are kept as text, they are processed after blocks are selected
+var lineDirectives = map[string]bool{
+	"REQUIRE":    true,
+	"REPLACE":    true,
+	"GPGCFG":     true,
+	"COMMENT":    true,
+	"FILE_BEGIN": true,
+	"FILE_END":   true,
+}
+
+// directives that close or split a block, which is named by the block directive
+var (
+	directiveEnds = map[string]string{
+		"IFDEF":        "ENDIF",
+		"IFDEF2":       "ENDIF2",
+		"SWITCH":       "ENDSWITCH",
+		"MULTISWITCH":  "ENDMULTISWITCH",
+		"CASE":         "ENDCASE",
+		"DEFAULT":      "ENDCASE",
+		"ONCE":         "END_ONCE",
+		"IGNORE_BEGIN": "IGNORE_END",
+		"GPONLY_BEGIN": "GPONLY_END",
+	}
+	directiveElifs = map[string]string{
+		"IFDEF":  "ELIF",
+		"IFDEF2": "ELIF2",
+	}
+	directiveElses = map[string]string{
+		"IFDEF":  "ELSE",
+		"IFDEF2": "ELSE2",
+	}
+)
+
+var (
+	gogpExpDirective = regexp.MustCompile(`^[ \t]*/{2,}[ \t]*#GOGP_([[:word:]]+)`)
+	gogpExpDirMap    = regexp.MustCompile(`^\((\S+)[ \t]*,[ \t]*(\S+)\)`)
+)
+
+// a token of gp file, which is a directive line or a piece of text
+type gpToken struct {
+	kind tokenKind
+	name string    //directive name without "#GOGP_", eg: "IFDEF2"
+	arg  string    //key of #GOGP_SWITCH, or src of #GOGP_MAP
+	dst  string    //dst of #GOGP_MAP
+	cond *condNode //condition of #GOGP_IFDEF, #GOGP_ELIF and #GOGP_CASE
+	tail string    //text after #GOGP_MAP(...) in the same line
+	text string    //source text of the token
+	err  string    //why the directive is invalid
+	line int       //position of the token, from 1
+	col  int
+}
+
+// a node of gp file syntax tree, which is a text or a block
+type gpNode struct {
+	tok      *gpToken
+	body     []*gpNode //content of #GOGP_ONCE and #GOGP_CASE, or true branch of #GOGP_IFDEF
+	elifs    []*gpNode //#GOGP_ELIF branches of #GOGP_IFDEF
+	els      *gpToken  //#GOGP_ELSE of #GOGP_IFDEF, nil if there is no false branch
+	elseBody []*gpNode //false branch of #GOGP_IFDEF
+	cases    []*gpNode //#GOGP_CASE and #GOGP_DEFAULT of #GOGP_SWITCH
+	end      *gpToken  //the directive that closes the block
+}
+
+// make the end of a directive line, skip following empty lines if skipEmpty
+func directiveLineEnd(content string, pos int, skipEmpty bool) int {
+	if i := strings.IndexByte(content[pos:], '\n'); i >= 0 {
+		pos += i + 1
+	} else {
+		pos = len(content)
+	}
+	if skipEmpty {
+		for pos < len(content) && (content[pos] == '\r' || content[pos] == '\n') {
+			pos++
+		}
+	}
+	return pos
+}
+
+// split gp file content into tokens, which ends with a tokEOF
+func tokenizeGp(content string) (toks []*gpToken) {
+	line := 1
+	addText := func(text string) {
+		if n := len(toks); n > 0 && toks[n-1].kind == tokText {
+			toks[n-1].text += text
+		} else {
+			toks = append(toks, &gpToken{kind: tokText, text: text, line: line, col: 1})
+		}
+	}
+
+	pos := 0
+	for pos < len(content) {
+		lineEnd := directiveLineEnd(content, pos, false)
+		m := gogpExpDirective.FindStringSubmatchIndex(content[pos:lineEnd])
+		if m == nil { //text line
+			addText(content[pos:lineEnd])
+			pos, line = lineEnd, line+1
+			continue
+		}
+
+		name := content[pos+m[2] : pos+m[3]]
+		if lineDirectives[name] {
+			addText(content[pos:lineEnd])
+			pos, line = lineEnd, line+1
+			continue
+		}
+
+		kind, ok := directiveKinds[name]
+		tok := &gpToken{kind: kind, name: name, line: line, col: m[2] - len("#GOGP_") + 1}
+		rest := strings.TrimRight(content[pos+m[1]:lineEnd], "\r\n")
+		end := lineEnd
+		switch {
+		case !ok:
+			tok.kind = tokInvalid
+			if name == "IGNORE_END" || name == "GPONLY_END" {
+				tok.err = fmt.Sprintf("unexpected #GOGP_%s", name)
+			} else {
+				tok.err = fmt.Sprintf("unknown directive #GOGP_%s", name)
+			}
+		case kind == tokIf || kind == tokElif || kind == tokCase:
+			cond, ce := parseCondition(rest)
+			if ce != nil { //column of the offending token
+				tok.kind, tok.col = tokInvalid, m[1]+ce.pos+1
+				tok.err = fmt.Sprintf("condition of #GOGP_%s: %s", name, ce.msg)
+				break
+			}
+			if cond == nil {
+				tok.kind, tok.err = tokInvalid, fmt.Sprintf("#GOGP_%s without condition", name)
+				break
+			}
+			tok.cond = cond
+			if kind == tokCase {
+				end = directiveLineEnd(content, pos, true)
+			}
+		case kind == tokSwitch:
+			key, ce := parseCondKey(rest)
+			if ce != nil {
+				tok.kind, tok.col = tokInvalid, m[1]+ce.pos+1
+				tok.err = fmt.Sprintf("key of #GOGP_%s: %s", name, ce.msg)
+				break
+			}
+			tok.arg = key
+		case kind == tokDefault || kind == tokEndCase || kind == tokOnce:
+			end = directiveLineEnd(content, pos, true)
+		case kind == tokMap:
+			c := gogpExpDirMap.FindStringSubmatchIndex(rest)
+			if c == nil {
+				tok.kind, tok.err = tokInvalid, "#GOGP_MAP without (<src>, <dst>)"
+				break
+			}
+			tok.arg, tok.dst = rest[c[2]:c[3]], rest[c[4]:c[5]]
+			tok.tail = content[pos+m[1]+c[1] : lineEnd]
+		case kind == tokIgnore: //content of ignored block is not parsed
+			endMark := "#GOGP_" + directiveEnds[name]
+			i := strings.Index(content[pos+m[1]:], endMark)
+			if i < 0 {
+				tok.kind, tok.err = tokInvalid, fmt.Sprintf("#GOGP_%s is not closed by %s", name, endMark)
+				break
+			}
+			end = directiveLineEnd(content, pos+m[1]+i, true)
+		}
+		tok.text = content[pos:end]
+		toks = append(toks, tok)
+		pos, line = end, line+strings.Count(tok.text, "\n")
+	}
+
+	i := strings.LastIndexByte(content, '\n')
+	return append(toks, &gpToken{kind: tokEOF, line: strings.Count(content, "\n") + 1, col: len(content) - i})
+}
+
+// parse gp file content into syntax tree
+func parseGp(file, content string) ([]*gpNode, error) {
+	p := &gpParser{file: file, toks: tokenizeGp(content)}
+	nodes, end, err := p.parseNodes(nil)
+	if err == nil && end.kind != tokEOF {
+		err = p.unexpected(end, nil)
+	}
+	return nodes, err
+}
+
+// recursive descent parser of gp file tokens
+type gpParser struct {
+	file string
+	toks []*gpToken
+	pos  int
+}
+
+// parse nodes in block until a directive that closes or splits a block, which is returned as end
+func (p *gpParser) parseNodes(block *gpToken) (nodes []*gpNode, end *gpToken, err error) {
+	for {
+		tok := p.next()
+		var node *gpNode
+		switch tok.kind {
+		case tokText, tokIgnore, tokMap:
+			node = &gpNode{tok: tok}
+		case tokIf, tokOnce:
+			node, err = p.parseBlock(tok)
+		case tokSwitch:
+			node, err = p.parseSwitch(tok)
+		case tokInvalid:
+			err = p.errorf(tok, block, "%s", tok.err)
+		default:
+			return nodes, tok, nil
+		}
+		if err != nil {
+			return
+		}
+		nodes = append(nodes, node)
+	}
+}
+
+// next token, it stays at tokEOF
+func (p *gpParser) next() *gpToken {
+	tok := p.toks[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// parse body of #GOGP_IFDEF, #GOGP_ONCE, #GOGP_CASE and #GOGP_DEFAULT
+func (p *gpParser) parseBlock(begin *gpToken) (node *gpNode, err error) {
+	node = &gpNode{tok: begin}
+	var end *gpToken
+	if node.body, end, err = p.parseNodes(begin); err != nil {
+		return
+	}
+	for end.kind == tokElif && end.name == directiveElifs[begin.name] {
+		elif := &gpNode{tok: end}
+		if elif.body, end, err = p.parseNodes(begin); err != nil {
+			return
+		}
+		node.elifs = append(node.elifs, elif)
+	}
+	if end.kind == tokElse && end.name == directiveElses[begin.name] {
+		node.els = end
+		if node.elseBody, end, err = p.parseNodes(begin); err != nil {
+			return
+		}
+	}
+	if end.name != directiveEnds[begin.name] {
+		return nil, p.unexpected(end, begin)
+	}
+	node.end = end
+	return
+}
+
+// parse cases of #GOGP_SWITCH and #GOGP_MULTISWITCH, text out of cases is dropped
+func (p *gpParser) parseSwitch(begin *gpToken) (node *gpNode, err error) {
+	node = &gpNode{tok: begin}
+	for {
+		tok := p.next()
+		switch {
+		case tok.kind == tokText:
+		case tok.kind == tokCase || tok.kind == tokDefault:
+			c, err := p.parseBlock(tok)
+			if err != nil {
+				return nil, err
+			}
+			node.cases = append(node.cases, c)
+		case tok.kind == tokInvalid:
+			return nil, p.errorf(tok, begin, "%s", tok.err)
+		case tok.kind == tokEndSwitch && tok.name == directiveEnds[begin.name]:
+			node.end = tok
+			return
+		default:
+			return nil, p.unexpected(tok, begin)
+		}
+	}
+}
+
+// error of an unexpected directive in block, or an unclosed block at the end of file
+func (p *gpParser) unexpected(tok, block *gpToken) error {
+	if tok.kind == tokEOF {
+		return p.errorf(tok, block, "missing #GOGP_%s at end of file", directiveEnds[block.name])
+	}
+	return p.errorf(tok, block, "unexpected #GOGP_%s", tok.name)
+}
+
+func (p *gpParser) errorf(tok, block *gpToken, format string, a ...interface{}) error {
+	err := &DirectiveError{
+		File: p.file,
+		Line: tok.line,
+		Col:  tok.col,
+		Msg:  fmt.Sprintf(format, a...),
+	}
+	if block != nil {
+		err.Block = "#GOGP_" + block.name
+		err.BlockLine, err.BlockCol = block.line, block.col
+	}
+	return err
+}
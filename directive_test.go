@@ -0,0 +1,169 @@
+package gogp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const tstGpNested = `<PACKAGE>
+
+//#GOGP_IFDEF KIND
+//#GOGP_SWITCH <VALUE_TYPE>
+//#GOGP_CASE int
+//#GOGP_IFDEF SIGNED
+const kind = "signed int"
+//#GOGP_ELSE
+//#GOGP_IFDEF !SIGNED
+const kind = "unsigned int"
+//#GOGP_ENDIF
+//#GOGP_ENDIF
+//#GOGP_ENDCASE
+//#GOGP_CASE string
+//#GOGP_IFDEF SIGNED
+const kind = "signed string"
+//#GOGP_ELIF KIND == yes && !(SIGNED || <VALUE_TYPE> == int)
+const kind = "yes string"
+//#GOGP_ELIF KIND
+const kind = "string"
+//#GOGP_ELSE
+const kind = "unknown string"
+//#GOGP_ENDIF
+//#GOGP_ENDCASE
+//#GOGP_DEFAULT
+const kind = "<VALUE_TYPE>"
+//#GOGP_ENDCASE
+//#GOGP_ENDSWITCH
+//#GOGP_ENDIF
+
+//#GOGP_SWITCH "VALUE_TYPE" //comment
+//#GOGP_CASE "map[string]int" || time.Duration
+//#GOGP_IFDEF <VALUE_TYPE> == "map[string]int" && !KIND
+const typ = "composite"
+//#GOGP_ENDIF
+//#GOGP_ENDCASE
+//#GOGP_ENDSWITCH
+
+//#GOGP_ONCE
+const once = 1
+
+//#GOGP_IFDEF KIND
+//#GOGP_ONCE
+const innerOnce = 1
+//#GOGP_END_ONCE
+//#GOGP_ENDIF
+//#GOGP_END_ONCE
+`
+
+func TestNestedDirectives(t *testing.T) {
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/demo/kind.gp":  tstGpNested,
+		"/app/demo/kind.gpg": "[kind_int]\nGOGP_GpFilePath=kind\nPACKAGE=package demo\nVALUE_TYPE=int\nKIND=true\nSIGNED=false\n\n[kind_string]\nGOGP_GpFilePath=kind\nPACKAGE=package demo\nVALUE_TYPE=string\nKIND=yes\n\n[kind_map]\nGOGP_GpFilePath=kind\nGOGP_CodeFileName=map\nPACKAGE=package demo\nVALUE_TYPE=map[string]int\n",
+	})
+	if r, err := NewRunner(Config{Silence: true, FS: fsys}).Work("/app"); err != nil || r.Err() != nil {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+	for file, want := range map[string][]string{
+		"/app/demo/kind.gp_int.go":    {`const kind = "unsigned int"`, "const once = 1", "const innerOnce = 1"},
+		"/app/demo/kind.gp_string.go": {`const kind = "yes string"`},
+		"/app/demo/kind.gp_map.go":    {`const typ = "composite"`},
+	} {
+		b, _ := fsys.ReadFile(file)
+		code := string(b)
+		for _, w := range want {
+			if strings.Count(code, w) != 1 {
+				t.Errorf("%s: want %q once, code:\n%s", file, w, code)
+			}
+		}
+		if strings.Count(code, "const ") != len(want) || strings.Contains(code, "#GOGP_") {
+			t.Errorf("%s: unexpected code:\n%s", file, code)
+		}
+	}
+}
+
+func TestParseGpErrors(t *testing.T) {
+	cases := []struct {
+		content string
+		err     string
+	}{
+		{"//#GOGP_IFDEF A\n//#GOGP_IGNORE_BEGIN\n//#GOGP_ENDIF\n//#GOGP_IGNORE_END\n", "f.gp:5:1: invalid directive: missing #GOGP_ENDIF at end of file (in #GOGP_IFDEF at f.gp:1:3)"},
+		{"x\n  // #GOGP_ENDCASE\n", "f.gp:2:6: invalid directive: unexpected #GOGP_ENDCASE"},
+		{"//#GOGP_SWITCH\n//#GOGP_CASE A\n//#GOGP_IFDEF\n", "f.gp:3:3: invalid directive: #GOGP_IFDEF without condition (in #GOGP_CASE at f.gp:2:3)"},
+		{"//#GOGP_IFDEF A\n//#GOGP_ELSE\n//#GOGP_ELIF B\n", "f.gp:3:3: invalid directive: unexpected #GOGP_ELIF (in #GOGP_IFDEF at f.gp:1:3)"},
+		{"//#GOGP_IFDEF A\n//  #GOGP_ELIF A && (B || C\n", `f.gp:2:28: invalid directive: condition of #GOGP_ELIF: unexpected end of condition, expect ")" (in #GOGP_IFDEF at f.gp:1:3)`},
+		{"//#GOGP_SWITCH !A\n", `f.gp:1:16: invalid directive: key of #GOGP_SWITCH: unexpected "!", expect a key or value`},
+		{"//#GOGP_SWITCH A B\n", `f.gp:1:18: invalid directive: key of #GOGP_SWITCH: unexpected "B", expect "//"`},
+		{"//#GOGP_SWITCH\n//#GOGP_CASE map[string]int\n", `f.gp:2:17: invalid directive: condition of #GOGP_CASE: unexpected '[', quote the value like "map[string]int" (in #GOGP_SWITCH at f.gp:1:3)`},
+		{"//#GOGP_IFDEF A & B\n", `f.gp:1:17: invalid directive: condition of #GOGP_IFDEF: unexpected '&'`},
+		{"//#GOGP_IFDEF (A))\n", `f.gp:1:18: invalid directive: condition of #GOGP_IFDEF: unexpected ")", expect "&&", "||" or "//"`},
+		{"//#GOGP_SWITCH\n//#GOGP_CASE int signed\n", `f.gp:2:18: invalid directive: condition of #GOGP_CASE: unexpected "signed", expect "&&", "||" or "//" (in #GOGP_SWITCH at f.gp:1:3)`},
+		{"//#GOGP_IFDEF A\n//#GOGP_ELIF\n", "f.gp:2:3: invalid directive: #GOGP_ELIF without condition (in #GOGP_IFDEF at f.gp:1:3)"},
+		{"//#GOGP_IFDEF A\n//#GOGP_ELSE\n//#GOGP_ENDIF2\n", "f.gp:3:3: invalid directive: unexpected #GOGP_ENDIF2 (in #GOGP_IFDEF at f.gp:1:3)"},
+		{"//#GOGP_SWITCH\n//#GOGP_CASE A\n\n\nx\n//#GOGP_ENDSWITCH\n", "f.gp:6:3: invalid directive: unexpected #GOGP_ENDSWITCH (in #GOGP_CASE at f.gp:2:3)"},
+		{"//#GOGP_ONCE\n//#GOGP_IFDEFF A\n//#GOGP_END_ONCE", "f.gp:2:3: invalid directive: unknown directive #GOGP_IFDEFF (in #GOGP_ONCE at f.gp:1:3)"},
+		{"//#GOGP_ONCE\nx\n//#GOGP_ONCE\n//#GOGP_END_ONCE\nx", "f.gp:5:2: invalid directive: missing #GOGP_END_ONCE at end of file (in #GOGP_ONCE at f.gp:1:3)"},
+		{"//#GOGP_GPONLY_BEGIN\n//#GOGP_IGNORE_END\n", "f.gp:1:3: invalid directive: #GOGP_GPONLY_BEGIN is not closed by #GOGP_GPONLY_END"},
+		{"//#GOGP_IGNORE_BEGIN\n//#GOGP_ENDIF\n//#GOGP_IGNORE_END\n//#GOGP_MAP(a, b)\n//#GOGP_REQUIRE(x)\n", ""},
+	}
+	for _, c := range cases {
+		_, err := parseGp("f.gp", c.content)
+		var de *DirectiveError
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%q: %v", c.content, err)
+		case c.err != "" && (!errors.Is(err, ErrDirective) || !errors.As(err, &de) || err.Error() != c.err):
+			t.Errorf("%q: got %v, want %q", c.content, err, c.err)
+		}
+	}
+}
+
+func TestWorkDirectiveError(t *testing.T) {
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/demo/box.gp":  tstGpBox + "//#GOGP_IFDEF VALUE_TYPE\n",
+		"/app/demo/box.gpg": tstGpgBox,
+	})
+	r, err := NewRunner(Config{Silence: true, FS: fsys}).Work("/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var de *DirectiveError
+	if failed := r.Failed(); len(failed) != 2 || !errors.As(failed[0].Err, &de) ||
+		de.File != "/app/demo/box.gp" || de.Line != 15 || de.BlockLine != 14 {
+		t.Fatalf("unexpected failures: %v", failed)
+	}
+	if _, err := fsys.Stat("/app/demo/box.gp_int.go"); err == nil {
+		t.Fatal("product of malformed gp file should not be written")
+	}
+}
+
+func TestConditionComment(t *testing.T) {
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/demo/box.gp": tstGpBox + `
+//#GOGP_IFDEF VALUE_TYPE == int //signed integer
+const a = 1
+//#GOGP_ELSE
+const a = 2
+//#GOGP_ENDIF
+//#GOGP_SWITCH VALUE_TYPE // of box
+//#GOGP_CASE string //- text of old style
+const b = 1
+//#GOGP_ENDCASE
+//#GOGP_DEFAULT
+const b = 2
+//#GOGP_ENDCASE
+//#GOGP_ENDSWITCH
+`,
+		"/app/demo/box.gpg": tstGpgBox,
+	})
+	if r, err := NewRunner(Config{Silence: true, FS: fsys, NoCache: true}).Work("/app"); err != nil || r.Err() != nil {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+	for file, want := range map[string]string{
+		"/app/demo/box.gp_int.go":    "const a = 1\nconst b = 2\n",
+		"/app/demo/box.gp_string.go": "const a = 2\nconst b = 1\n",
+	} {
+		if b, _ := fsys.ReadFile(file); !strings.Contains(string(b), want) {
+			t.Errorf("%s: want %q, code:\n%s", file, want, b)
+		}
+	}
+}
@@ -6,21 +6,58 @@ usage of gogp tool:
 
     Tool gogp is a generic-programming solution for golang or any other languages.
     Usage:
-      gogp [-e|ext=<Ext>] [-f|force=<force>] [-m|more=<more>] [-remove=<remove>] [<filePath>]
+      gogp [-e|ext=<Ext>] [-f|force=<force>] [-j|jobs=<jobs>] [-m|more=<more>] [-remove=<remove>] [-check=<check>] [-dry-run|diff=<dryRun>] [-exclude=<exclude>] [-transactional=<transactional>] [-log-format=<logFormat>] [<filePath>]
     -e|ext=<Ext>  string
       Code file ext name. [.go] is default. [.gp] and [.gpg] is not allowed.
     -f|force=<force>
-      Force update all products.
+      Force update all products, even if they are modified manually.
+    -j|jobs=<jobs>  int
+      Number of gpg directories processed in parallel.
     -m|more=<more>
       More information in working process.
     -remove=<remove>
       Only remove all products.
+    -check=<check>
+      Check if products are up to date without writing anything, exit non-zero if not.
+    -dry-run|diff=<dryRun>
+      Print unified diffs of all products that would be changed without writing anything.
+    -exclude=<exclude>
+      Pattern of paths to exclude in syntax of .gogpignore, it can be repeated. vendor, .git, testdata, node_modules and .gogp are excluded by default.
+    -transactional=<transactional>
+      Write products only if every gpg, section and product succeeds, otherwise roll back all changes.
+    -log-format=<logFormat>  string
+      Format of log records and report, [text] or [json]. [text] is default. Every record of json is a line of JSON object.
     <filePath>  string
-      Path that gogp will work. GoPath and WorkPath is allowed.
+      Path that gogp will work. GoPath and WorkPath is allowed. A gpg file or a section of it like <file.gpg>[:<section>] is allowed too.
 
     usage samples:
       gogp
       gogp gopath
+      gogp ./...
+      gogp examples/example.gpg
+      gogp examples/example.gpg:list_int
+      gogp generate -diff ./...
+      gogp prune
+
+    subcommands, run "gogp help <command>" for flags of every subcommand:
+      gogp generate [<filePath>]  generate code files from gp files, only the produce step is run
+      gogp reverse [<filePath>]   rebuild gp files from fake go files, only the reverse step is run
+      gogp require [<filePath>]   expand #GOGP_REQUIRE in fake go files, only the require step is run
+      gogp clean [<filePath>]     remove all products
+      gogp prune [<filePath>]     remove generated files that are no longer produced
+      gogp check [<filePath>]     check if products are up to date, exit non-zero if not
+      gogp render [<filePath>]    print all files that gogp produces to stdout
+      gogp lint [<filePath>]      report errors of gpg files, gp files and products
+      gogp which [-open] <file>   tell which gp file, gpg file and section a generated file comes from
+
+    manage sections and keys of gpg files without editing them by hand:
+      gogp gpg list <gpgFile> [<section>]
+      gogp gpg set <gpgFile> <section> <key=value>...
+      gogp gpg copy <gpgFile> <section> <newSection> [<key=value>...]
+      gogp gpg delete <gpgFile> <section> [<key>...]
+      gogp gpg rename <gpgFile> <section> <newSection>
+    eg:
+      gogp gpg set examples/example.gpg list_float VALUE_TYPE=float64
 
   2. package usage:
 
@@ -39,6 +76,23 @@ usage of gogp tool:
           gogp.WorkOnGoPath()
       }
 
+    2.3 embed gogp in build tools, and get result of every gpg, section and product
+      runner := gogp.NewRunner(gogp.Config{ForceUpdate: true}) //state is scoped to one run
+      r, err := runner.Work(dir)
+      if err == nil {
+          err = r.Err() //failures of gpg files, sections and products
+      }
+      r.Render(os.Stdout, true)
+
+    2.4 run gogp on an in-memory tree, eg: hermetic tests of templates or previews
+      fsys := gogp.NewMemFileSystem(map[string]string{"/demo/box.gp": gp, "/demo/box.gpg": gpg})
+      r, err := gogp.NewRunner(gogp.Config{FS: fsys}).Work("/demo")
+      code, err := fsys.ReadFile("/demo/box.gp_int.go")
+
+    2.5 work on a single gpg file or section, sections it depends on are processed too
+      r, err := gogp.WorkFile("examples/example.gpg")
+      r, err := gogp.WorkSection("examples/example.gpg", "list_int")
+
 Detail desctription:
     Tool Site: https://github.com/vipally/gogp
     Work flow: DummyGoFile  --(GPGFile[1])-->  gp_file  --(GPGFile[2])-->  real_go_files
@@ -60,6 +114,10 @@ Detail desctription:
     2. GPG files(.gpg)
       GPG file is an ini-format file, that defines key-value replacing cases from
     source to the product.
+      Lines lead with ";" or "#" are comments, values can be quoted as "..." with escapes
+    or '...' without escapes, and a line ends with "\" is continued at next line.
+      Sections and keys are processed in order of declaration, duplicate sections or
+    keys and malformed lines are reported with file:line.
       "GOGP_IGNORE_xxx" style sections will be ignored by gogp tool.
       "GOGP_REVERSE_xxx" style sections are defined for reverse-mode to generate
     GP file from DummyGoFiles.
@@ -67,22 +125,67 @@ Detail desctription:
       "GOGP_xxx" style keys are reserved by gogp tool which will never be replacing with.
       Corresponding GP file may with the same path and name.
       But we can redirect it by key "GOGP_GpFilePath".
+      An import-path-like GOGP_GpFilePath(and #GOGP_REQUIRE path) is resolved by
+    go.mod module path, replace directives, go.work workspace and module cache,
+    then every entry of GOPATH.
       Key "GOGP_Name" is used to specify gp file name in reverse flow.
       And specify go-file-name-suffix in normal flow.
 
     3. GP files(.gp)
       A go-like file, but exists some <xxx> style keys,
       that need to be replaced with which defined in GPG file.
+      Malformed or unbalanced #GOGP_* directives are reported as gp-file:line:column with the start
+    of the enclosing block, and every <KEY> that has no replacing is reported with its line and column.
 
     4. GO files(.go)
       gogp tool auto-generated GO files are exactly normal go code files.
-      But never modify it manually, you can see this warning infomation at each file head.
-      Auto work on GoPath is recmmended.
-      gogp tool will deep travel the path to find all gpg files for processing.
-      If the generated go code file's body has no changes, this file will not be updated.
+      But never modify it manually, you can see this warning infomation at each file head,
+    which starts with the standard mark "// Code generated by gogp. DO NOT EDIT.".
+      The file head has no time stamp but a fingerprint of inputs(hash of gp file, hash of
+    gpg section and version of gogp), so output is reproducible byte-for-byte.
+      If the fingerprint and body of the generated go code file have no changes, this file will not be updated.
       So run gogp tool any times on GoPath is harmless, unless there are indeed changes.
-      So any manually modification will be restored by this tool.
+      The file head has a checksum of its body, a product modified manually is not overwritten or removed
+    unless -force is given, and the gpg file and section that it comes from are reported.
       Take care of that.
+      The file head has a parseable provenance line too, like // Provenance: src="list.gp" gpg="list.gpg" section="list_int",
+    paths are related to the generated file. "gogp which" and gogp.Provenance(path) read it.
+
+    5. Paths
+      Auto work on GoPath is recmmended.
+      In module mode, it works on the main module or go.work workspace of working path instead.
+      gogp tool will deep travel the path to find all gpg files for processing.
+      Paths like vendor, .git, testdata, node_modules and .gogp, paths matched by patterns
+    of .gogpignore files(syntax of .gitignore) in the path and its sub dirs, and paths matched
+    by -exclude are skipped.
+      Go-style package patterns like ./... and github.com/x/y/... are allowed too.
+      If the path is a gpg file, or a section of it like <file.gpg>:<section>, only this file or section
+    and GOGP_REVERSE sections that generate gp files it uses(or requires) are processed. These sections
+    are found in gpg files of the same root, or by the provenance of the gp files.
+
+    6. Subcommands, flags and modes
+      Without subcommand, gogp runs every step on the path: require, reverse and produce.
+    A subcommand runs one step or one mode, and "gogp help <command>" shows its flags.
+      -check(or "gogp check") reports products that are out of date without writing anything,
+    and exits non-zero if any. -dry-run(or -diff) prints unified diffs of them instead.
+      -remove(or "gogp clean") removes all products. "gogp prune" removes generated files that are
+    no longer produced, like products of deleted or renamed sections.
+      -transactional stages all outputs in memory, and writes them only if every gpg, section
+    and product succeeds, otherwise nothing is changed and the failure is reported.
+      -jobs processes gpg directories in parallel.
+      Messages are log records of levels(debug, info, warn, error) with fields like step, gpg, section, gp
+    and product. -log-format=json writes them and the report as lines of JSON objects, and Config.Logger
+    of gogp package takes them in embedding applications.
+
+    7. Data of gogp(.gogp)
+      gogp keeps its data in .gogp of module root(or the working path).
+      A build cache in .gogp/cache maps hashes of inputs of every product to hashes of files it
+    renders, so unchanged products are skipped without rendering.
+      Concurrent runs on the same root are serialized by an advisory lock of .gogp/lock, and every
+    file is written atomically by a temp file and rename, permissions of existing files are kept.
+      Every file gogp has written is recorded with its gpg file and section in .gogp/manifest.
+    "gogp prune" finds generated files by the manifest and the provenance of file head.
+    Products of excluded gpg files are kept, and nothing is pruned if any gpg, section or product fails.
 
 More gogp details:
 
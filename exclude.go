@@ -0,0 +1,225 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gogp
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// name of file that lists patterns of paths to exclude, in syntax of .gitignore
+const ignoreFile = ".gogpignore"
+
+// paths excluded by default, they can be re-included by patterns like "!testdata"
+var defaultExcludes = []string{"vendor", ".git", "testdata", "node_modules", dataDir}
+
+// a pattern of .gogpignore, in syntax of .gitignore
+type ignoreRule struct {
+	base     string   //dir that pattern is related to, slash separated
+	elems    []string //elements of pattern split by "/", "**" matches any number of dirs
+	negate   bool     //"!pattern", re-include paths excluded by previous patterns
+	dirOnly  bool     //"pattern/", match dirs only
+	anchored bool     //pattern has a "/" other than the trailing one, it is related to base
+}
+
+// parse a line of .gogpignore, blank lines and comments lead with "#" are ignored
+func parseIgnoreRule(base, line string) (rule ignoreRule, ok bool) {
+	line = strings.TrimRight(line, " \t\r")
+	switch {
+	case line == "" || line[0] == '#':
+		return
+	case line[0] == '!':
+		rule.negate, line = true, line[1:]
+	case strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`):
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly, line = true, strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored, line = true, strings.TrimLeft(line, "/")
+	}
+	if line == "" {
+		return
+	}
+	rule.base, rule.elems, ok = path.Clean(filepath.ToSlash(base)), strings.Split(line, "/"), true
+	return
+}
+
+// check if slash separated path matches the rule
+func (rule *ignoreRule) match(name string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	rel, ok := memRel(rule.base, name)
+	if !ok {
+		return false
+	}
+	elems := strings.Split(rel, "/")
+	if !rule.anchored { //match name at any depth
+		return len(rule.elems) == 1 && matchIgnoreElem(rule.elems[0], elems[len(elems)-1])
+	}
+	return matchIgnoreElems(rule.elems, elems)
+}
+
+func matchIgnoreElems(pattern, elems []string) bool {
+	for ; len(pattern) > 0; pattern, elems = pattern[1:], elems[1:] {
+		if pattern[0] == "**" {
+			if pattern = pattern[1:]; len(pattern) == 0 { //"dir/**" matches everything in dir
+				return len(elems) > 0
+			}
+			for i := range elems {
+				if matchIgnoreElems(pattern, elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 || !matchIgnoreElem(pattern[0], elems[0]) {
+			return false
+		}
+	}
+	return len(elems) == 0
+}
+
+func matchIgnoreElem(pattern, name string) bool {
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// patterns to exclude paths, the last matched one decides
+type ignoreList []ignoreRule
+
+// parse lines of patterns related to base
+func (l *ignoreList) add(base string, lines ...string) {
+	for _, line := range lines {
+		if rule, ok := parseIgnoreRule(base, line); ok {
+			*l = append(*l, rule)
+		}
+	}
+}
+
+// check if slash separated path is excluded, excluded is the result of patterns before l
+func (l ignoreList) excluded(name string, isDir, excluded bool) bool {
+	for i := range l {
+		if l[i].match(name, isDir) {
+			excluded = !l[i].negate
+		}
+	}
+	return excluded
+}
+
+// walker collects files with extension in a dir tree.
+// It skips excluded paths, and never stops by unreadable paths or broken symlinks.
+type walker struct {
+	fsys     FileSystem
+	ext      string
+	patterns []string                     //patterns to exclude, they take precedence over .gogpignore files
+	warn     func(path string, err error) //report paths that are skipped by errors
+
+	rules    ignoreList //default excludes and patterns of .gogpignore files
+	excludes ignoreList //patterns of w.patterns
+}
+
+// deep find files with extension ext in dir
+func (w *walker) collect(dir string) (files []string, err error) {
+	w.rules, w.excludes = nil, nil
+	w.rules.add(dir, defaultExcludes...)
+	w.excludes.add(dir, w.patterns...)
+	err = w.fsys.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if name == dir { //the dir itself is not accessible
+				return err
+			}
+			w.warn(name, err)
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		isDir := info.IsDir()
+		if name != dir && w.excludes.excluded(filepath.ToSlash(name), isDir, w.rules.excluded(filepath.ToSlash(name), isDir, false)) {
+			if isDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case isDir:
+			w.loadIgnoreFile(name)
+		case w.ext != "" && filepath.Ext(name) != w.ext:
+		case info.Mode()&os.ModeSymlink != 0: //follow symlinks to files only, to avoid loops
+			if target, err := w.fsys.Stat(name); err != nil {
+				w.warn(name, err)
+			} else if !target.IsDir() {
+				files = append(files, name)
+			}
+		default:
+			files = append(files, name)
+		}
+		return nil
+	})
+	return
+}
+
+// load patterns of .gogpignore in dir, if it exists
+func (w *walker) loadIgnoreFile(dir string) {
+	file := filepath.Join(dir, ignoreFile)
+	b, err := w.fsys.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			w.warn(file, err)
+		}
+		return
+	}
+	w.rules.add(dir, strings.Split(string(bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)), "\n")...)
+}
+
+// get dir to walk of Go-style package pattern like "./..." or "github.com/x/y/...".
+// Relative dirs lead with "." are related to working path, and import paths are resolved by modules and GoPath.
+func packagePatternDir(fsys FileSystem, pattern string) (dir string, ok bool) {
+	if dir = filepath.ToSlash(pattern); !strings.HasSuffix(dir, "/...") {
+		return "", false
+	}
+	switch dir = strings.TrimSuffix(dir, "/..."); {
+	case filepath.IsAbs(dir):
+	case dir == "." || dir == ".." || strings.HasPrefix(dir, "./") || strings.HasPrefix(dir, "../"):
+		dir = filepath.Join(workPath(), dir)
+	default:
+		dir = resolveImportPath(fsys, workPath(), dir)
+	}
+	return dir, true
+}
+
+// log warning of a skipped path
+func (r *Runner) walkWarning(path string, err error) {
+	r.log(LevelWarn, "skip path", Field{"path", relateGoPath(r.fsys, filepath.ToSlash(path))}, Field{"err", err})
+}
@@ -0,0 +1,161 @@
+package gogp
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIgnoreRule(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		match   bool
+	}{
+		{"vendor", "/p/vendor", true, true},
+		{"vendor", "/p/a/vendor", true, true},
+		{"vendor", "/p/a/vendor.gpg", false, false},
+		{"*.gpg", "/p/a/x.gpg", false, true},
+		{"tmp/", "/p/a/tmp", false, false},
+		{"tmp/", "/p/a/tmp", true, true},
+		{"/a", "/p/a", true, true},
+		{"/a", "/p/b/a", true, false},
+		{"a/x.gpg", "/p/a/x.gpg", false, true},
+		{"a/x.gpg", "/p/b/a/x.gpg", false, false},
+		{"**/gen", "/p/a/b/gen", true, true},
+		{"**/gen", "/p/gen", true, true},
+		{"a/**/x.gpg", "/p/a/x.gpg", false, true},
+		{"a/**/x.gpg", "/p/a/b/c/x.gpg", false, true},
+		{"a/**", "/p/a/b", true, true},
+		{"a/**", "/p/a", true, false},
+		{"x.gpg", "/q/x.gpg", false, false},
+	}
+	for _, c := range cases {
+		rule, ok := parseIgnoreRule("/p", c.pattern)
+		if !ok {
+			t.Fatalf("%s: not a rule", c.pattern)
+		}
+		if got := rule.match(c.path, c.isDir); got != c.match {
+			t.Errorf("%s %s: got %v", c.pattern, c.path, got)
+		}
+	}
+	for _, line := range []string{"", "   ", "# comment", "/", "!"} {
+		if _, ok := parseIgnoreRule("/p", line); ok {
+			t.Errorf("%q should not be a rule", line)
+		}
+	}
+	if rule, ok := parseIgnoreRule("/p", `\#x`); !ok || !rule.match("/p/#x", false) {
+		t.Errorf("escaped # should match: %v", rule)
+	}
+}
+
+func TestWalkerExcludes(t *testing.T) {
+	fsys := NewMemFileSystem(map[string]string{
+		"/p/a.gpg":                  "",
+		"/p/.gogpignore":            "# ignore generated dirs\ngen/\n*_old.gpg\n",
+		"/p/vendor/v.gpg":           "",
+		"/p/.git/g.gpg":             "",
+		"/p/node_modules/n.gpg":     "",
+		"/p/testdata/t.gpg":         "",
+		"/p/x/gen/g.gpg":            "",
+		"/p/x/b_old.gpg":            "",
+		"/p/x/b.gpg":                "",
+		"/p/x/.gogpignore":          "!b_old.gpg\n",
+		"/p/y/c.gpg":                "",
+		"/p/y/c.go":                 "",
+		"/p/y/sub/testdata/t.gpg":   "",
+		"/p/y/sub/testdata/.keep":   "",
+		"/p/z/testdata/keep/k.gpg":  "",
+		"/p/z/testdata/other/o.gpg": "",
+	})
+	w := &walker{fsys: fsys, ext: gpgExt, patterns: []string{"y", "!z/testdata", "z/testdata/other/"},
+		warn: func(path string, err error) { t.Errorf("%s: %v", path, err) }}
+	files, err := w.collect("/p")
+	expect := []string{"/p/a.gpg", "/p/x/b.gpg", "/p/x/b_old.gpg", "/p/z/testdata/keep/k.gpg"}
+	if err != nil || !reflect.DeepEqual(files, expect) {
+		t.Fatalf("err=%v files=%v", err, files)
+	}
+
+	//root is never excluded
+	if files, err = w.collect("/p/vendor"); err != nil || !reflect.DeepEqual(files, []string{"/p/vendor/v.gpg"}) {
+		t.Fatalf("err=%v files=%v", err, files)
+	}
+	if _, err = w.collect("/none"); !os.IsNotExist(err) {
+		t.Fatalf("expect not exist, got %v", err)
+	}
+}
+
+// errWalkFS reports a permission error when walking into dir bad
+type errWalkFS struct {
+	*MemFileSystem
+	bad string
+}
+
+func (e errWalkFS) Walk(root string, fn filepath.WalkFunc) error {
+	return e.MemFileSystem.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if path == e.bad {
+			return fn(path, info, os.ErrPermission)
+		}
+		return fn(path, info, err)
+	})
+}
+
+func TestWalkerErrors(t *testing.T) {
+	fsys := errWalkFS{NewMemFileSystem(map[string]string{
+		"/p/a.gpg":       "",
+		"/p/bad/b.gpg":   "",
+		"/p/good/c.gpg":  "",
+		"/p/good/d.gpg":  "",
+		"/p/good/e.gptx": "",
+	}), "/p/bad"}
+	var skipped []string
+	w := &walker{fsys: fsys, ext: gpgExt, warn: func(path string, err error) { skipped = append(skipped, path) }}
+	files, err := w.collect("/p")
+	if err != nil || !reflect.DeepEqual(files, []string{"/p/a.gpg", "/p/good/c.gpg", "/p/good/d.gpg"}) {
+		t.Fatalf("err=%v files=%v", err, files)
+	}
+	if !reflect.DeepEqual(skipped, []string{"/p/bad"}) {
+		t.Fatalf("skipped=%v", skipped)
+	}
+
+	//broken symlinks are skipped on OS file system
+	dir := t.TempDir()
+	testWriteFile(t, filepath.Join(dir, "real", "a.gpg"), "")
+	if err := os.Symlink(filepath.Join(dir, "real", "a.gpg"), filepath.Join(dir, "link.gpg")); err != nil {
+		t.Skip(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "none.gpg"), filepath.Join(dir, "broken.gpg")); err != nil {
+		t.Skip(err)
+	}
+	skipped = nil
+	w.fsys = OSFileSystem{}
+	files, err = w.collect(dir)
+	expect := []string{filepath.Join(dir, "link.gpg"), filepath.Join(dir, "real", "a.gpg")}
+	if err != nil || !reflect.DeepEqual(files, expect) {
+		t.Fatalf("err=%v files=%v", err, files)
+	}
+	if !reflect.DeepEqual(skipped, []string{filepath.Join(dir, "broken.gpg")}) {
+		t.Fatalf("skipped=%v", skipped)
+	}
+}
+
+func TestPackagePatternDir(t *testing.T) {
+	wd := workPath()
+	cases := []struct {
+		pattern, dir string
+		ok           bool
+	}{
+		{"./...", wd, true},
+		{"./a/b/...", filepath.Join(wd, "a/b"), true},
+		{"/p/...", "/p", true},
+		{"./a", "", false},
+		{"gopath", "", false},
+	}
+	for _, c := range cases {
+		if dir, ok := packagePatternDir(OSFileSystem{}, c.pattern); dir != c.dir || ok != c.ok {
+			t.Errorf("%s: got %q %v", c.pattern, dir, ok)
+		}
+	}
+}
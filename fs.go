@@ -0,0 +1,311 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gogp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileSystem is a writable file system that gogp works on.
+// All file access of gogp work process goes through it,
+// so gogp can run on an in-memory tree as well as the OS file system.
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error //parent dirs are created if needed
+	Remove(name string) error
+	Stat(name string) (os.FileInfo, error)
+	Walk(root string, fn filepath.WalkFunc) error //the same as filepath.Walk
+}
+
+// OSFileSystem is the FileSystem of OS.
+type OSFileSystem struct{}
+
+func (OSFileSystem) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+// WriteFile writes file atomically by a temp file and rename, so readers never see a half-written file.
+// Permissions of existing file are kept, and new file is created with 0666 before umask.
+func (OSFileSystem) WriteFile(name string, data []byte) (err error) {
+	if real, e := filepath.EvalSymlinks(name); e == nil { //write to target of symlink
+		name = real
+	}
+	if err = os.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
+		return
+	}
+	perm, keep := os.FileMode(0666), false
+	if info, e := os.Stat(name); e == nil {
+		perm, keep = info.Mode().Perm(), true
+	}
+
+	var f *os.File
+	tmp := ""
+	for i := 0; ; i++ { //temp file in the same dir, so it can be renamed atomically
+		tmp = filepath.Join(filepath.Dir(name), fmt.Sprintf(".%s.%d.%d.tmp", filepath.Base(name), os.Getpid(), i))
+		if f, err = os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm); !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if err == nil && keep { //umask may change permissions of temp file
+		err = f.Chmod(perm)
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return
+}
+
+func (OSFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFileSystem) Walk(root string, fn filepath.WalkFunc) error {
+	return filepath.Walk(root, fn)
+}
+
+// MemFileSystem is an in-memory FileSystem.
+// Directories are implied by paths of files, so writing a file never fails.
+type MemFileSystem struct {
+	lock  sync.RWMutex
+	files map[string]*memFile //slash separated clean path -> file
+}
+
+type memFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemFileSystem create a MemFileSystem with files, which maps path to content.
+func NewMemFileSystem(files map[string]string) *MemFileSystem {
+	m := &MemFileSystem{files: make(map[string]*memFile)}
+	for name, content := range files {
+		m.WriteFile(name, []byte(content))
+	}
+	return m
+}
+
+func memPath(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+func (m *MemFileSystem) ReadFile(name string) ([]byte, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	f, ok := m.files[memPath(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return append([]byte(nil), f.data...), nil
+}
+
+func (m *MemFileSystem) WriteFile(name string, data []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.files[memPath(name)] = &memFile{data: append([]byte(nil), data...), modTime: time.Now()}
+	return nil
+}
+
+func (m *MemFileSystem) Remove(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	p := memPath(name)
+	if _, ok := m.files[p]; !ok {
+		err := os.ErrNotExist
+		if m.isDir(p) {
+			err = os.ErrExist //not empty dir
+		}
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	delete(m.files, p)
+	return nil
+}
+
+func (m *MemFileSystem) Stat(name string) (os.FileInfo, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	p := memPath(name)
+	if f, ok := m.files[p]; ok {
+		return &memFileInfo{name: path.Base(p), size: int64(len(f.data)), modTime: f.modTime}, nil
+	}
+	if m.isDir(p) {
+		return &memFileInfo{name: path.Base(p), dir: true}, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+// Walk walks the tree like filepath.Walk, files and dirs are visited in lexical order.
+func (m *MemFileSystem) Walk(root string, fn filepath.WalkFunc) error {
+	info, err := m.Stat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	if !info.IsDir() {
+		return fn(root, info, nil)
+	}
+
+	//collect relative paths of files and dirs in root
+	p := memPath(root)
+	m.lock.RLock()
+	entries := make(map[string]bool) //relative path -> is dir
+	for name := range m.files {
+		rel, ok := memRel(p, name)
+		if !ok {
+			continue
+		}
+		entries[rel] = false
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			entries[dir] = true
+		}
+	}
+	m.lock.RUnlock()
+	list := make([]string, 0, len(entries))
+	for rel := range entries {
+		list = append(list, rel)
+	}
+	sort.Slice(list, func(i, j int) bool { return memPathLess(list[i], list[j]) })
+
+	if err = fn(root, info, nil); err != nil {
+		if err == filepath.SkipDir {
+			err = nil
+		}
+		return err
+	}
+	skip := "" //entries with this prefix are skipped
+	for _, rel := range list {
+		if skip != "" && strings.HasPrefix(rel, skip) {
+			continue
+		}
+		name := filepath.Join(root, filepath.FromSlash(rel))
+		info, err := m.Stat(name)
+		if err != nil { //removed while walking
+			continue
+		}
+		if err = fn(name, info, nil); err != nil {
+			if err != filepath.SkipDir {
+				return err
+			}
+			if entries[rel] { //skip the dir
+				skip = rel + "/"
+			} else if dir := path.Dir(rel); dir != "." { //skip the rest of parent dir
+				skip = dir + "/"
+			} else {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// Paths returns sorted paths of all files.
+func (m *MemFileSystem) Paths() []string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	l := make([]string, 0, len(m.files))
+	for name := range m.files {
+		l = append(l, name)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// check if p is a dir that contains some files, lock must be held
+func (m *MemFileSystem) isDir(p string) bool {
+	for name := range m.files {
+		if _, ok := memRel(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// get path of name related to dir, ok is false if name is not in dir
+func memRel(dir, name string) (rel string, ok bool) {
+	switch {
+	case dir == ".":
+		return name, !path.IsAbs(name) && name != ".." && !strings.HasPrefix(name, "../")
+	case dir == "/":
+		return name[1:], strings.HasPrefix(name, "/") && name != "/"
+	case strings.HasPrefix(name, dir+"/"):
+		return name[len(dir)+1:], true
+	}
+	return "", false
+}
+
+// compare paths element by element, which is the order of filepath.Walk
+func memPathLess(a, b string) bool {
+	ea, eb := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(ea) && i < len(eb); i++ {
+		if ea[i] != eb[i] {
+			return ea[i] < eb[i]
+		}
+	}
+	return len(ea) < len(eb)
+}
+
+// memFileInfo is os.FileInfo of files in memory
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return i.size }
+func (i *memFileInfo) ModTime() time.Time { return i.modTime }
+func (i *memFileInfo) IsDir() bool        { return i.dir }
+func (i *memFileInfo) Sys() interface{}   { return nil }
+
+func (i *memFileInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0777
+	}
+	return 0666
+}
@@ -0,0 +1,99 @@
+package gogp
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMemFileSystem(t *testing.T) {
+	m := NewMemFileSystem(map[string]string{
+		"/p/a/x.gpg":  "x",
+		"/p/a.b":      "ab",
+		"/p/a/b/y.gp": "y",
+		"/p/c/z.gpg":  "z",
+		"/q/w.gpg":    "w",
+	})
+
+	if b, err := m.ReadFile("/p/a/../a.b"); err != nil || string(b) != "ab" {
+		t.Errorf("ReadFile: %q %v", b, err)
+	}
+	if info, err := m.Stat("/p/a"); err != nil || !info.IsDir() {
+		t.Errorf("Stat dir: %v %v", info, err)
+	}
+	if _, err := m.Stat("/p/none"); !os.IsNotExist(err) {
+		t.Errorf("Stat not exist: %v", err)
+	}
+
+	var walked []string
+	err := m.Walk("/p", func(path string, info os.FileInfo, err error) error {
+		walked = append(walked, filepath.ToSlash(path))
+		if info.Name() == "b" {
+			return filepath.SkipDir
+		}
+		return err
+	})
+	want := []string{"/p", "/p/a", "/p/a/b", "/p/a/x.gpg", "/p/a.b", "/p/c", "/p/c/z.gpg"}
+	if err != nil || !reflect.DeepEqual(walked, want) {
+		t.Errorf("Walk: %v %v", walked, err)
+	}
+
+	if err := m.Remove("/p/a"); err == nil {
+		t.Errorf("Remove not empty dir should fail")
+	}
+	if err := m.Remove("/p/a.b"); err != nil {
+		t.Errorf("Remove: %v", err)
+	}
+	if err := m.Remove("/p/a.b"); !os.IsNotExist(err) {
+		t.Errorf("Remove twice: %v", err)
+	}
+	if got, want := m.Paths(), []string{"/p/a/b/y.gp", "/p/a/x.gpg", "/p/c/z.gpg", "/q/w.gpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Paths: %v", got)
+	}
+}
+
+func TestOSWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	fsys := OSFileSystem{}
+
+	//new file is created like ioutil.WriteFile with 0666
+	ref := filepath.Join(dir, "ref")
+	testWriteFile(t, ref, "")
+	refInfo, _ := os.Stat(ref)
+	name := filepath.Join(dir, "sub", "a.go")
+	if err := fsys.WriteFile(name, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(name); err != nil || info.Mode() != refInfo.Mode() {
+		t.Fatalf("mode of new file: %v %v", info.Mode(), err)
+	}
+
+	//permissions of existing file are kept
+	if err := os.Chmod(name, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile(name, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(name); err != nil || info.Mode().Perm() != 0640 || testReadFile(t, name) != "b" {
+		t.Fatalf("mode of existing file: %v %v", info.Mode(), err)
+	}
+
+	//symlink is kept, and its target is written
+	link := filepath.Join(dir, "link.go")
+	if err := os.Symlink(name, link); err == nil {
+		if err := fsys.WriteFile(link, []byte("c")); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 || testReadFile(t, name) != "c" {
+			t.Fatalf("symlink: %v %v", info.Mode(), err)
+		}
+	}
+
+	//no temp files are left
+	files, _ := filepath.Glob(filepath.Join(dir, "sub", ".*"))
+	if len(files) != 0 {
+		t.Fatalf("temp files are left: %v", files)
+	}
+}
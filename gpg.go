@@ -28,13 +28,15 @@
 package gogp
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"go/build"
 	"go/format"
 	"hash/crc32"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/vipally/cmdline"
 	"github.com/vipally/cpright"
@@ -44,22 +46,18 @@ const (
 	gpgExt           = ".gpg"
 	gpExt            = ".gp"
 	gpCodeFileSuffix = "gp"
+	defaultCodeExt   = ".go"
 
 	thisFilePath = "github.com/gxlb/gogp/gpg.go"
 	libVersion   = "v4.0.0"
 )
 
 var (
-	goPath                = "" //GoPath
-	copyRightCode         = ""
-	codeExt               = ".go"
-	optForceUpdate        = false //force update all products
-	optSilence            = true  //work silencely
-	optRemoveProductsOnly = false //remove products only
-
-	onceMap       map[string]bool //record once processed files
-	savedCodeFile map[string]bool //record saved code files
-	debug         = false         //debug switch
+	goPath        = ""     //GoPath, src dir of the first entry of GOPATH
+	goPathOthers  []string //src dirs of the other entries of GOPATH
+	copyRightCode = ""
+
+	defaultConfig = Config{Silence: true} //config of package level work functions
 )
 
 func init() {
@@ -67,51 +65,64 @@ func init() {
 	copyRightCode = cmdline.FormatLineHead(cpright.CopyRight(), "// ")
 	copyRightCode = cmdline.ReplaceTags(copyRightCode)
 
-	//get GoPath
-	s := os.Getenv("GOPATH")
-	if ss := strings.Split(s, ";"); ss != nil && len(ss) > 0 {
-		goPath = formatPath(ss[0]) + "/src/"
+	//get GoPath, entries of GOPATH are separated by os.PathListSeparator
+	for i, p := range filepath.SplitList(build.Default.GOPATH) {
+		src := filepath.ToSlash(filepath.Clean(p)) + "/src/"
+		if i == 0 {
+			goPath = src
+		} else {
+			goPathOthers = append(goPathOthers, src)
+		}
 	}
-	onceMap = make(map[string]bool)
-	savedCodeFile = make(map[string]bool)
 }
 
 // enable/disable work mode RemoveProductsOnly.
 func RemoveProductsOnly(enable bool) (old bool) {
-	old, optRemoveProductsOnly = optRemoveProductsOnly, enable
+	old, defaultConfig.RemoveProductsOnly = defaultConfig.RemoveProductsOnly, enable
 	return
 }
 
 //set debug mode flag.
 func Debug(enable bool) (old bool) {
-	old, debug = debug, enable
+	old, defaultConfig.Debug = defaultConfig.Debug, enable
 	return
 }
 
 //set silence work mode flag.
 func Silence(enable bool) (old bool) {
-	old, optSilence = optSilence, enable
+	old, defaultConfig.Silence = defaultConfig.Silence, enable
 	return
 }
 
 //set force update product flag.
 func ForceUpdate(enable bool) (old bool) {
-	old, optForceUpdate = optForceUpdate, enable
+	old, defaultConfig.ForceUpdate = defaultConfig.ForceUpdate, enable
+	return
+}
+
+//set logger of work process, text to stdout if nil.
+func SetLogger(l Logger) (old Logger) {
+	old, defaultConfig.Logger = defaultConfig.Logger, l
 	return
 }
 
 //set extension of code file, ".go" is default
 func CodeExtName(n string) (old string) {
-	old = codeExt
-	if n != "" && codeExt != n && n != gpExt && n != gpgExt {
-		codeExt = n
+	old = defaultConfig.codeExt()
+	if n != "" && n != gpExt && n != gpgExt {
+		defaultConfig.CodeExt = n
 	}
 	return
 }
 
-//run work process on GoPath
+// get config of package level work functions
+func DefaultConfig() Config {
+	return defaultConfig
+}
+
+//run work process on GoPath, or on main module or go.work workspace of working path in module mode
 func WorkOnGoPath() (nGpg, nCode, nSkip int, err error) {
-	return Work(goPath)
+	return Work("")
 }
 
 //run work process on current working path
@@ -121,52 +132,25 @@ func WorkOnWorkPath() (nGpg, nCode, nSkip int, err error) {
 
 // work, gen code from gp file
 func Work(dir string) (nGpg, nCode, nSkip int, err error) {
-	defer func() {
-		if err != nil {
-			fmt.Println(err)
-		}
-		//fmt.Printf("[gogp]Work(%s) end: gpg=%d code=%d skip=%d\n", relateGoPath(dir), nGpg, nCode, nSkip)
-	}()
-
-	start := time.Now()
-
-	if dir == "" || strings.ToLower(dir) == "gopath" { //if not set a dir,use GoPath
-		dir = goPath
-	} else if dir == "." || strings.ToLower(dir) == "workpath" {
-		dir = workPath()
-	}
-	dir = formatPath(dir)
-	//println(dir)
-
-	var list []string
-	if list, err = deepCollectSubFiles(dir, gpgExt); err == nil {
-		//fmt.Println("list", list)
-		if !optSilence && len(list) > 0 {
-			fmt.Printf("[gogp]Working at:[%s]\n", relateGoPath(dir))
-		}
-
-		steps := getProcessingSteps(optRemoveProductsOnly)
-		nGpg = len(list)
-		for _, step := range steps {
-			for _, gpg := range list {
-				var p gopgProcessor
-				if err = p.procGpg(gpg, step); err != nil {
-					return
-				}
-				nCode += p.nCodeFile
-				nSkip += p.nSkipCodeFile
-			}
-		}
+	var r *Report
+	if r, err = WorkReport(dir); err == nil {
+		err = r.Err()
 	}
-
-	if true || !optSilence { //always show this message
-		cost := time.Now().Sub(start)
-		fmt.Printf("[gogp][%s] %d/%d product(s) updated from %d gpg file(s) in %s.\n", relateGoPath(dir), nCode, nCode+nSkip, nGpg, cost)
+	if r != nil {
+		nGpg = len(r.Gpgs)
+		nCode = r.Count(StatusWritten) + r.Count(StatusRemoved)
+		nSkip = r.Count(StatusSkipped)
 	}
-
 	return
 }
 
+// work, gen code from gp file, and report result of every gpg, section and product.
+// Failures of gpg files and sections are recorded in report instead of returned.
+// It runs a new Runner with config set by package level functions such as ForceUpdate.
+func WorkReport(dir string) (r *Report, err error) {
+	return NewRunner(defaultConfig).Work(dir)
+}
+
 //get version of this gogp lib
 func Version() string {
 	return libVersion
@@ -181,18 +165,32 @@ func getTxtFileBeginContent(open bool) (r string) {
 	return
 }
 
-func relateGoPath(full string) string {
+// get src dirs of all entries of GOPATH
+func goPathList() []string {
+	return append([]string{goPath}, goPathOthers...)
+}
+
+// get root dir of GoPath
+func goPathRoot() string {
+	return filepath.Dir(filepath.Clean(goPath))
+}
+
+// get path related to GoPath, or related to module if it is out of GoPath
+func relateGoPath(fsys FileSystem, full string) string {
 	fp := filepath.ToSlash(filepath.Clean(full))
-	fg := formatPath(goPath)
-	//println("relateGoPath", fp, fg)
-	if !filepath.HasPrefix(fp, fg) {
-		return fp
+	for _, src := range goPathList() {
+		if src != "" && strings.HasPrefix(fp, src) {
+			return strings.TrimPrefix(fp, src)
+		}
+	}
+	if p, ok := relateModule(fsys, full); ok {
+		return p
 	}
-	return strings.TrimPrefix(fp, goPath)
+	return fp
 }
 func expadGoPath(path string) (r string) {
 	r = path
-	if filepath.VolumeName(path) == "" {
+	if !filepath.IsAbs(path) {
 		r = filepath.Join(goPath, path)
 	}
 	return
@@ -211,17 +209,6 @@ func workPath() (p string) {
 	return
 }
 
-//deep find the file path
-func deepCollectSubFiles(_dir string, ext string) (subfiles []string, err error) {
-	err = filepath.Walk(_dir, func(path string, info os.FileInfo, err error) error {
-		if !info.IsDir() && (ext == "" || filepath.Ext(path) == ext) {
-			subfiles = append(subfiles, path)
-		}
-		return err
-	})
-	return
-}
-
 func getHash(s string) string {
 	h := crc32.NewIEEE()
 	h.Write([]byte(s))
@@ -229,12 +216,16 @@ func getHash(s string) string {
 	return r
 }
 
-func goFmt(s, file string) (r string) {
-	if b, e := format.Source([]byte(s)); e != nil {
-		fmt.Println(relateGoPath(file), e)
-		r = s
-	} else {
-		r = string(b)
+//hash of content, to fingerprint inputs of products
+func contentHash(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:8])
+}
+
+func goFmt(s string) (r string, err error) {
+	var b []byte
+	if b, err = format.Source([]byte(s)); err != nil {
+		return s, fmt.Errorf("%w: %s", ErrGoFmt, err.Error())
 	}
-	return
+	return string(b), nil
 }
@@ -0,0 +1,237 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ini
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// AddSection adds an empty section at the end of file.
+func (p *IniFile) AddSection(sec string) error {
+	if err := checkName("section", sec); err != nil {
+		return err
+	}
+	if _, ok := p.index[sec]; ok {
+		return fmt.Errorf("ini: section [%s] already exists", sec)
+	}
+	pre := p.tail
+	if last, ok := p.lastLine(); ok && strings.TrimSpace(last) != "" {
+		pre = append(pre, "") //a blank line between sections
+	}
+	s := p.addSection(sec, Pos{})
+	s.pre, s.raw = pre, []string{"[" + sec + "]"}
+	p.tail = nil
+	return nil
+}
+
+// RenameSection renames section sec to newName.
+func (p *IniFile) RenameSection(sec, newName string) error {
+	if err := checkName("section", newName); err != nil {
+		return err
+	}
+	s, ok := p.index[sec]
+	if !ok {
+		return fmt.Errorf("ini: section [%s] does not exist", sec)
+	}
+	if _, ok := p.index[newName]; ok {
+		return fmt.Errorf("ini: section [%s] already exists", newName)
+	}
+	delete(p.index, sec)
+	s.name, s.raw = newName, []string{"[" + newName + "]"}
+	p.index[newName] = s
+	return nil
+}
+
+// RemoveSection removes section sec with its keys and the comments just before it.
+// It returns false if the section does not exist.
+func (p *IniFile) RemoveSection(sec string) bool {
+	s, ok := p.index[sec]
+	if !ok {
+		return false
+	}
+	i := p.sectionIndex(s)
+	p.sections = append(p.sections[:i], p.sections[i+1:]...)
+	delete(p.index, sec)
+	if i < len(p.sections) {
+		next := p.sections[i]
+		next.pre = append(detachComments(s.pre), next.pre...)
+	} else {
+		p.tail = append(detachComments(s.pre), p.tail...)
+	}
+	return true
+}
+
+// SetString sets value of key in section sec.
+// The section is added if it does not exist, and a new key is added after the last key of section.
+func (p *IniFile) SetString(sec, key, value string) error {
+	if err := checkName("key", key); err != nil {
+		return err
+	}
+	if strings.Contains(key, "=") || strings.IndexAny(key, "[;#") == 0 {
+		return fmt.Errorf("ini: invalid key name %q", key)
+	}
+	s, ok := p.index[sec]
+	if !ok {
+		if err := p.AddSection(sec); err != nil {
+			return err
+		}
+		s = p.index[sec]
+	}
+	k, ok := s.index[key]
+	if !ok {
+		k = s.addKey(key, value, Pos{})
+	}
+	k.value, k.raw = value, []string{key + "=" + quote(value)}
+	return nil
+}
+
+// DeleteKey removes key with the comments just before it from section sec.
+// It returns false if the key does not exist.
+func (p *IniFile) DeleteKey(sec, key string) bool {
+	s, ok := p.index[sec]
+	if !ok {
+		return false
+	}
+	k, ok := s.index[key]
+	if !ok {
+		return false
+	}
+	i := 0
+	for s.keys[i] != k {
+		i++
+	}
+	s.keys = append(s.keys[:i], s.keys[i+1:]...)
+	delete(s.index, key)
+
+	keep := detachComments(k.pre)
+	switch j := p.sectionIndex(s); {
+	case i < len(s.keys):
+		s.keys[i].pre = append(keep, s.keys[i].pre...)
+	case j+1 < len(p.sections):
+		p.sections[j+1].pre = append(keep, p.sections[j+1].pre...)
+	default:
+		p.tail = append(keep, p.tail...)
+	}
+	return true
+}
+
+// WriteTo writes ini file to w.
+// Sections and keys that have not been changed are written as they are read.
+func (p *IniFile) WriteTo(w io.Writer) (n int64, err error) {
+	var b bytes.Buffer
+	p.walkLines(func(line string) {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	})
+	return b.WriteTo(w)
+}
+
+// Bytes returns content of ini file.
+func (p *IniFile) Bytes() []byte {
+	var b bytes.Buffer
+	p.WriteTo(&b)
+	return b.Bytes()
+}
+
+// FileWriter writes whole content of a file, eg: FileSystem of package gogp.
+type FileWriter interface {
+	WriteFile(name string, data []byte) error
+}
+
+// Save writes ini file to path by w.
+// With OSFileSystem of package gogp, the file is replaced atomically and its permissions are kept.
+func (p *IniFile) Save(w FileWriter, path string) error {
+	return w.WriteFile(path, p.Bytes())
+}
+
+// visit all lines in order
+func (p *IniFile) walkLines(f func(line string)) {
+	visit := func(lines []string) {
+		for _, l := range lines {
+			f(l)
+		}
+	}
+	for _, s := range p.sections {
+		visit(s.pre)
+		visit(s.raw)
+		for _, k := range s.keys {
+			visit(k.pre)
+			visit(k.raw)
+		}
+	}
+	visit(p.tail)
+}
+
+// get the last line of file
+func (p *IniFile) lastLine() (last string, ok bool) {
+	p.walkLines(func(line string) {
+		last, ok = line, true
+	})
+	return
+}
+
+func (p *IniFile) sectionIndex(s *section) int {
+	for i, v := range p.sections {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// get lines that are kept when the section or key after them is removed.
+// Comments just before a section or key belong to it, the others are kept.
+func detachComments(pre []string) []string {
+	for i := len(pre) - 1; i >= 0; i-- {
+		if strings.TrimSpace(pre[i]) == "" {
+			return pre[:i:i]
+		}
+	}
+	return nil
+}
+
+// check name of section or key
+func checkName(kind, name string) error {
+	if name == "" || name != strings.TrimSpace(name) || strings.ContainsAny(name, "\r\n") {
+		return fmt.Errorf("ini: invalid %s name %q", kind, name)
+	}
+	return nil
+}
+
+// quote value if it can not be read back as it is
+func quote(v string) string {
+	if v != "" && (v != strings.TrimSpace(v) || v[0] == '"' || v[0] == '\'' ||
+		strings.HasSuffix(v, "\\") || strings.ContainsAny(v, "\r\n")) {
+		return strconv.Quote(v)
+	}
+	return v
+}
@@ -25,20 +25,101 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
 // SOFTWARE.
 
-//ini file reader
+//ini file reader and writer
+//
+//An ini file is made of sections of key-value pairs:
+//
+//	;comment line, "#" is also allowed
+//	[section]
+//	key=value
+//	quoted="value with \"escapes\"\n and spaces around "
+//	raw='value without escapes'
+//	long=value that is continued \
+//	     at next line
+//
+//Sections and keys keep their order and position(file:line) in file.
+//Comments and layout of the file are kept when it is edited and saved.
 package ini
 
 import (
 	"bufio"
+	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 )
 
-type section map[string]string
+// Pos is a position in ini file.
+type Pos struct {
+	File string
+	Line int
+}
+
+func (p Pos) String() string {
+	if p.File == "" {
+		return strconv.Itoa(p.Line)
+	}
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// Error is an error at a position of ini file.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// ErrorList is a list of errors of ini file.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns an error equivalent to this error list, or nil if the list is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+type key struct {
+	name  string
+	value string
+	pos   Pos
+	pre   []string //comment, blank and malformed lines before the key
+	raw   []string //lines of the key, more than one if it is continued
+}
+
+type section struct {
+	name  string
+	pos   Pos
+	pre   []string //comment, blank and malformed lines before the section header
+	raw   []string //line of the section header
+	keys  []*key
+	index map[string]*key
+}
 
 type IniFile struct {
-	sections map[string]section
+	sections []*section
+	index    map[string]*section
+	tail     []string //comment and blank lines at the end of file
+}
+
+func newIniFile() *IniFile {
+	return &IniFile{index: make(map[string]*section)}
 }
 
 func New(path string) (*IniFile, error) {
@@ -49,83 +130,189 @@ func New(path string) (*IniFile, error) {
 	defer func() {
 		f.Close()
 	}()
-	r := Load(f)
-	return r, nil
-}
-
-func Load(f io.Reader) *IniFile {
-	m := make(map[string]section)
-	r := bufio.NewReader(f)
-	sec := ""
-	var line string
-	var err error
-	for err == nil {
-		line, err = r.ReadString('\n')
-		line = strings.TrimSpace(line)
-		if line == "" || line[0] == ';' {
+	return Parse(path, f)
+}
+
+func Load(f io.Reader) (*IniFile, error) {
+	return Parse("", f)
+}
+
+// Parse parses ini file from r, name is the file name used in positions.
+// If there are errors, the parsed part is returned with an ErrorList.
+func Parse(name string, r io.Reader) (*IniFile, error) {
+	p := newIniFile()
+	var errs ErrorList
+	errorf := func(pos Pos, format string, a ...interface{}) {
+		errs = append(errs, &Error{Pos: pos, Msg: fmt.Sprintf(format, a...)})
+	}
+
+	var sec *section
+	var logic bytes.Buffer //logic line joined by continuation
+	var pos Pos            //position of the first line of logic line
+	var raw []string       //lines of logic line
+	var pending []string   //lines that are not owned by any section or key
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		raw = append(raw, scanner.Text())
+		line := strings.TrimSpace(scanner.Text())
+		if logic.Len() == 0 {
+			pos = Pos{File: name, Line: lineNo}
+			if line == "" || line[0] == ';' || line[0] == '#' {
+				pending = append(pending, raw...)
+				raw = nil
+				continue
+			}
+		}
+		if strings.HasSuffix(line, "\\") { //line continuation
+			logic.WriteString(line[:len(line)-1])
 			continue
 		}
-		if line[0] == '[' && line[len(line)-1] == ']' {
-			sec = line[1 : len(line)-1]
-			_, ok := m[sec]
-			if !ok {
-				m[sec] = make(section)
+		logic.WriteString(line)
+		line = logic.String()
+		logic.Reset()
+		pending = append(pending, raw...) //owned by section or key later
+		lines := raw
+		raw = nil
+		own := func() []string { //get lines before logic line
+			pre := pending[:len(pending)-len(lines)]
+			pending = nil
+			return pre
+		}
+
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				errorf(pos, "malformed section header %q", line)
+				continue
+			}
+			secName := strings.TrimSpace(line[1 : len(line)-1])
+			if secName == "" {
+				errorf(pos, "empty section name")
+				continue
 			}
+			if prev, ok := p.index[secName]; ok {
+				errorf(pos, "duplicate section [%s], previous declaration at %s", secName, prev.pos)
+				sec = prev
+				continue
+			}
+			sec = p.addSection(secName, pos)
+			sec.pre, sec.raw = own(), lines
 			continue
 		}
-		if sec == "" {
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			errorf(pos, "malformed line %q, expect key=value", line)
 			continue
 		}
-		pair := strings.SplitN(line, "=", 2)
-		val := ""
-		if len(pair) < 1 || len(pair) > 2 {
+		keyName := strings.TrimSpace(line[:eq])
+		if keyName == "" {
+			errorf(pos, "empty key name")
 			continue
 		}
-		if len(pair) == 2 {
-			val = pair[1]
+		if sec == nil {
+			errorf(pos, "key %s is out of section", keyName)
+			continue
+		}
+		value, err := unquote(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			errorf(pos, "malformed value of key %s: %s", keyName, err)
+			continue
 		}
-		key := strings.TrimSpace(pair[0])
-		val = strings.TrimSpace(val)
-		if key == "" {
+		if prev, ok := sec.index[keyName]; ok {
+			errorf(pos, "duplicate key %s in section [%s], previous declaration at %s", keyName, sec.name, prev.pos)
 			continue
 		}
-		m[sec][key] = val
+		k := sec.addKey(keyName, value, pos)
+		k.pre, k.raw = own(), lines
+	}
+	p.tail = append(pending, raw...)
+	if err := scanner.Err(); err != nil {
+		return p, err
+	}
+	if logic.Len() > 0 {
+		errorf(pos, "line continuation at end of file")
+	}
+	return p, errs.Err()
+}
+
+// unquote value in double quotes with escapes, or in single quotes without escapes
+func unquote(v string) (string, error) {
+	if len(v) == 0 {
+		return v, nil
+	}
+	switch q := v[0]; q {
+	case '"':
+		return strconv.Unquote(v)
+	case '\'':
+		if len(v) < 2 || v[len(v)-1] != q {
+			return "", strconv.ErrSyntax
+		}
+		return v[1 : len(v)-1], nil
 	}
-	return &IniFile{m}
+	return v, nil
+}
+
+func (p *IniFile) addSection(name string, pos Pos) *section {
+	s := &section{name: name, pos: pos, index: make(map[string]*key)}
+	p.sections = append(p.sections, s)
+	p.index[name] = s
+	return s
+}
+
+func (s *section) addKey(name, value string, pos Pos) *key {
+	k := &key{name: name, value: value, pos: pos}
+	s.keys = append(s.keys, k)
+	s.index[name] = k
+	return k
 }
 
+// Sections returns names of sections in order of declaration.
 func (p *IniFile) Sections() []string {
 	s := make([]string, len(p.sections))
-	i := 0
-	for k, _ := range p.sections {
-		s[i] = k
-		i++
+	for i, sec := range p.sections {
+		s[i] = sec.name
 	}
 	return s
 }
 
+// Keys returns keys of section sec in order of declaration, or nil if sec does not exist.
 func (p *IniFile) Keys(sec string) []string {
-	m, ok := p.sections[sec]
+	m, ok := p.index[sec]
 	if !ok {
 		return nil
 	}
-	keys := make([]string, len(m))
-	i := 0
-	for key, _ := range m {
-		keys[i] = key
-		i++
+	keys := make([]string, len(m.keys))
+	for i, k := range m.keys {
+		keys[i] = k.name
 	}
 	return keys
 }
 
 func (p *IniFile) GetString(sec, key, def string) string {
-	m, ok := p.sections[sec]
+	m, ok := p.index[sec]
 	if !ok {
 		return def
 	}
-	v, ok := m[key]
+	v, ok := m.index[key]
 	if !ok {
 		return def
 	}
-	return v
+	return v.value
+}
+
+// Pos returns position of key in section sec, or position of section sec if key is empty.
+func (p *IniFile) Pos(sec, key string) (pos Pos, ok bool) {
+	s, ok := p.index[sec]
+	if !ok {
+		return
+	}
+	if key == "" {
+		return s.pos, true
+	}
+	k, ok := s.index[key]
+	if !ok {
+		return
+	}
+	return k.pos, true
 }
@@ -0,0 +1,178 @@
+package ini
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	src := `;comment
+# another comment
+[b]
+z=1
+a = 2 
+[a]
+quoted="x \"y\"\tz "
+raw='a\nb'
+empty=
+long=first \
+     second \
+third
+`
+	f, err := Parse("t.gpg", strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Sections(); !reflect.DeepEqual(got, []string{"b", "a"}) {
+		t.Errorf("sections: %v", got)
+	}
+	if got := f.Keys("b"); !reflect.DeepEqual(got, []string{"z", "a"}) {
+		t.Errorf("keys: %v", got)
+	}
+	if f.Keys("none") != nil {
+		t.Errorf("keys of missing section should be nil")
+	}
+	values := map[string]string{
+		"quoted": "x \"y\"\tz ",
+		"raw":    `a\nb`,
+		"empty":  "",
+		"long":   "first second third",
+	}
+	for k, want := range values {
+		if got := f.GetString("a", k, "def"); got != want {
+			t.Errorf("%s: got %q want %q", k, got, want)
+		}
+	}
+	if got := f.GetString("a", "none", "def"); got != "def" {
+		t.Errorf("default: %q", got)
+	}
+	if pos, ok := f.Pos("b", "a"); !ok || pos.String() != "t.gpg:5" {
+		t.Errorf("pos of key: %v %v", pos, ok)
+	}
+	if pos, ok := f.Pos("a", ""); !ok || pos.String() != "t.gpg:6" {
+		t.Errorf("pos of section: %v %v", pos, ok)
+	}
+	if pos, ok := f.Pos("a", "long"); !ok || pos.Line != 10 {
+		t.Errorf("pos of continued key: %v %v", pos, ok)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	src := `k=out of section
+[a]
+k=1
+k=2
+no equal sign
+=v
+[a]
+[b
+[ ]
+q="unterminated
+tail=x \`
+	_, err := Parse("t.gpg", strings.NewReader(src))
+	l, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("expect ErrorList, got %v", err)
+	}
+	want := []string{
+		"t.gpg:1: key k is out of section",
+		"t.gpg:4: duplicate key k in section [a], previous declaration at t.gpg:3",
+		`t.gpg:5: malformed line "no equal sign", expect key=value`,
+		"t.gpg:6: empty key name",
+		"t.gpg:7: duplicate section [a], previous declaration at t.gpg:2",
+		`t.gpg:8: malformed section header "[b"`,
+		"t.gpg:9: empty section name",
+		"t.gpg:10: malformed value of key q: invalid syntax",
+		"t.gpg:11: line continuation at end of file",
+	}
+	var got []string
+	for _, e := range l {
+		got = append(got, e.Error())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if !strings.HasSuffix(err.Error(), "(and 8 more errors)") {
+		t.Errorf("error: %v", err)
+	}
+}
+
+type testWriter map[string]string
+
+func (w testWriter) WriteFile(name string, data []byte) error {
+	w[name] = string(data)
+	return nil
+}
+
+func TestEdit(t *testing.T) {
+	src := `;this is a gpg file
+
+;comment of a
+[a]
+x=1
+;comment of y
+y = 2
+
+[b]
+z=3 \
+  4
+;end of file
+`
+	f, err := Load(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(f.Bytes()); got != src {
+		t.Fatalf("round trip:\n%s", got)
+	}
+
+	edits := []struct {
+		edit func() error
+		want string
+	}{
+		{func() error { return f.SetString("a", "x", "one") }, ";this is a gpg file\n\n;comment of a\n[a]\nx=one\n;comment of y\ny = 2\n\n[b]\nz=3 \\\n  4\n;end of file\n"},
+		{func() error { return f.SetString("b", "w", " quoted\n") }, ";this is a gpg file\n\n;comment of a\n[a]\nx=one\n;comment of y\ny = 2\n\n[b]\nz=3 \\\n  4\nw=\" quoted\\n\"\n;end of file\n"},
+		{func() error { f.DeleteKey("a", "y"); return nil }, ";this is a gpg file\n\n;comment of a\n[a]\nx=one\n\n[b]\nz=3 \\\n  4\nw=\" quoted\\n\"\n;end of file\n"},
+		{func() error { return f.SetString("c", "k", "v") }, ";this is a gpg file\n\n;comment of a\n[a]\nx=one\n\n[b]\nz=3 \\\n  4\nw=\" quoted\\n\"\n;end of file\n\n[c]\nk=v\n"},
+		{func() error { return f.RenameSection("b", "bb") }, ";this is a gpg file\n\n;comment of a\n[a]\nx=one\n\n[bb]\nz=3 \\\n  4\nw=\" quoted\\n\"\n;end of file\n\n[c]\nk=v\n"},
+		{func() error { f.RemoveSection("a"); return nil }, ";this is a gpg file\n\n[bb]\nz=3 \\\n  4\nw=\" quoted\\n\"\n;end of file\n\n[c]\nk=v\n"},
+	}
+	for i, e := range edits {
+		if err := e.edit(); err != nil {
+			t.Fatalf("edit %d: %v", i, err)
+		}
+		if got := string(f.Bytes()); got != e.want {
+			t.Fatalf("edit %d: got\n%s\nwant\n%s", i, got, e.want)
+		}
+	}
+
+	//read back
+	w := testWriter{}
+	if err := f.Save(w, "a.gpg"); err != nil {
+		t.Fatal(err)
+	}
+	g, err := Load(strings.NewReader(w["a.gpg"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.GetString("bb", "w", ""); got != " quoted\n" {
+		t.Errorf("read back: %q", got)
+	}
+	if got := g.Sections(); !reflect.DeepEqual(got, []string{"bb", "c"}) {
+		t.Errorf("sections: %v", got)
+	}
+
+	if err := f.RenameSection("c", "bb"); err == nil {
+		t.Errorf("rename to an existing section should fail")
+	}
+	if err := f.AddSection("c"); err == nil {
+		t.Errorf("add an existing section should fail")
+	}
+	if err := f.SetString("c", "a=b", "v"); err == nil {
+		t.Errorf("invalid key name should fail")
+	}
+	if f.DeleteKey("c", "none") || f.RemoveSection("none") {
+		t.Errorf("delete missing key or section should return false")
+	}
+}
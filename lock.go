@@ -0,0 +1,100 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gogp
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const lockName = "lock" //lock file of a run in dataDir
+
+// locker is implemented by file systems that support advisory locks across processes.
+type locker interface {
+	Lock(file string) (unlock func() error, err error)
+}
+
+// Lock locks file exclusively, and creates it if it does not exist.
+// It blocks until the lock is acquired, and it is not reentrant.
+func (OSFileSystem) Lock(file string) (unlock func() error, err error) {
+	if err = os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return
+	}
+	var f *os.File
+	if f, err = os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0666); err != nil {
+		return
+	}
+	if err = lockFile(f); err != nil {
+		f.Close()
+		return
+	}
+	unlock = func() error {
+		err := unlockFile(f)
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		return err
+	}
+	return
+}
+
+// lock roots of dirs for this run, so concurrent gogp processes never write the same files at the same time.
+// Every distinct root is locked in sorted order, so runs on overlapping roots never deadlock.
+// Runs in memory are never locked.
+func (r *Runner) lockRoots(dirs ...string) {
+	l, ok := r.fileSystem().(locker)
+	if !ok || r.inMemory() {
+		return
+	}
+	var files []string
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if file := filepath.Join(dataRoot(r.fileSystem(), dir), dataDir, lockName); !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		unlock, err := l.Lock(file)
+		if err != nil { //work without lock of this root, writes are still atomic
+			r.log(LevelWarn, "lock failed", Field{"path", relateGoPath(r.fsys, filepath.ToSlash(file))}, Field{"err", err})
+			continue
+		}
+		r.unlocks = append(r.unlocks, unlock)
+	}
+}
+
+// release locks of this run in reverse order
+func (r *Runner) unlockRoots() {
+	for i := len(r.unlocks) - 1; i >= 0; i-- {
+		r.unlocks[i]()
+	}
+	r.unlocks = nil
+}
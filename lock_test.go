@@ -0,0 +1,95 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows
+// +build darwin dragonfly freebsd linux netbsd openbsd windows
+
+package gogp
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOSLock(t *testing.T) {
+	file := filepath.Join(t.TempDir(), dataDir, lockName)
+	unlock, err := OSFileSystem{}.Lock(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan struct{})
+	go func() {
+		unlock2, err := OSFileSystem{}.Lock(file)
+		if err != nil {
+			t.Error(err)
+		} else {
+			unlock2()
+		}
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("file is locked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err = unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock is not released")
+	}
+}
+
+func TestConcurrentRuns(t *testing.T) {
+	src := testGoPath(t, map[string]string{
+		"demo/box.gp":  tstGpBox,
+		"demo/box.gpg": tstGpgBox,
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := NewRunner(Config{Silence: true, ForceUpdate: true}).Work("demo")
+			if err == nil {
+				err = r.Err()
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if code := testReadFile(t, src+"demo/box.gp_int.go"); !strings.HasPrefix(code, txtGeneratedMark) || !strings.Contains(code, "func (b *IntBox) Get() int {") {
+		t.Fatalf("broken product:\n%s", code)
+	}
+}
+
+// lockFS records locks in order
+type lockFS struct {
+	*MemFileSystem
+	locks *[]string
+}
+
+func (f lockFS) Lock(file string) (unlock func() error, err error) {
+	*f.locks = append(*f.locks, "lock "+filepath.ToSlash(file))
+	return func() error {
+		*f.locks = append(*f.locks, "unlock "+filepath.ToSlash(file))
+		return nil
+	}, nil
+}
+
+func TestLockRoots(t *testing.T) {
+	var locks []string
+	r := NewRunner(Config{Silence: true, FS: lockFS{NewMemFileSystem(map[string]string{"/b/go.mod": "module b\n"}), &locks}})
+	r.reset()
+	r.lockRoots("/b/y", "/a", "/b/x")
+	r.unlockRoots()
+	want := []string{"lock /a/.gogp/lock", "lock /b/.gogp/lock", "unlock /b/.gogp/lock", "unlock /a/.gogp/lock"}
+	if !reflect.DeepEqual(locks, want) {
+		t.Fatalf("got %v\nwant %v", locks, want)
+	}
+}
@@ -0,0 +1,233 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gogp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Level is the severity of a log record.
+type Level int
+
+const (
+	LevelDebug Level = iota //details of processing, logged in Debug mode only
+	LevelInfo               //progress of work, not logged in Silence mode
+	LevelWarn               //something may be wrong, but work goes on
+	LevelError              //something is wrong
+)
+
+func (l Level) String() (s string) {
+	switch l {
+	case LevelDebug:
+		s = "debug"
+	case LevelInfo:
+		s = "info"
+	case LevelWarn:
+		s = "warn"
+	case LevelError:
+		s = "error"
+	default:
+		s = "unknown"
+	}
+	return
+}
+
+// Field is a structured field of a log record.
+// Fields about processing are step, gpg, section, gp and product, others are like key, path and err.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger receives log records of gogp.
+// Set Config.Logger to redirect, filter or structure them.
+// Records of a run are logged in the same order in parallel mode, but Log may be called by different goroutines.
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+// NewTextLogger makes a Logger that writes records as lines like "[gogp warn]: msg key=value".
+func NewTextLogger(w io.Writer) Logger {
+	return &textLogger{w: w}
+}
+
+// NewJSONLogger makes a Logger that writes records as lines of JSON objects like
+// {"level":"warn","msg":"msg","key":"value"}, fields are kept in order.
+func NewJSONLogger(w io.Writer) Logger {
+	return &jsonLogger{w: w}
+}
+
+var stdoutLogger = NewTextLogger(os.Stdout) //default logger
+
+type textLogger struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (l *textLogger) Log(level Level, msg string, fields ...Field) {
+	var b strings.Builder
+	if level == LevelInfo {
+		b.WriteString("[gogp] ")
+	} else {
+		fmt.Fprintf(&b, "[gogp %s]: ", level)
+	}
+	b.WriteString(msg)
+	for _, f := range fields {
+		v := fmt.Sprint(f.Value)
+		if v == "" || strings.ContainsAny(v, " \t\r\n\"") {
+			v = strconv.Quote(v)
+		}
+		fmt.Fprintf(&b, " %s=%s", f.Key, v)
+	}
+	b.WriteByte('\n')
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	io.WriteString(l.w, b.String())
+}
+
+type jsonLogger struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (l *jsonLogger) Log(level Level, msg string, fields ...Field) {
+	var b strings.Builder
+	fmt.Fprintf(&b, `{"level":%q,"msg":%s`, level, jsonValue(msg))
+	for _, f := range fields {
+		fmt.Fprintf(&b, ",%s:%s", jsonValue(f.Key), jsonValue(f.Value))
+	}
+	b.WriteString("}\n")
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	io.WriteString(l.w, b.String())
+}
+
+// get JSON of v, errors and values that can not be marshaled are written as strings
+func jsonValue(v interface{}) string {
+	if e, ok := v.(error); ok {
+		v = e.Error()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return string(b)
+}
+
+// discardLogger drops all records
+type discardLogger struct{}
+
+func (discardLogger) Log(level Level, msg string, fields ...Field) {}
+
+// log function of processor or runner
+type logFunc func(level Level, msg string, fields ...Field)
+
+type logRecord struct {
+	level  Level
+	msg    string
+	fields []Field
+}
+
+// bufferLogger keeps records of a group in parallel mode,
+// so they can be logged in order of groups.
+type bufferLogger struct {
+	records []logRecord
+}
+
+func (l *bufferLogger) Log(level Level, msg string, fields ...Field) {
+	l.records = append(l.records, logRecord{level, msg, fields})
+}
+
+// log all records to to
+func (l *bufferLogger) flush(to Logger) {
+	for _, r := range l.records {
+		to.Log(r.level, r.msg, r.fields...)
+	}
+	l.records = nil
+}
+
+// logger of this run, text to stdout by default
+func (r *Runner) logger() Logger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+	return stdoutLogger
+}
+
+// check if records of level are logged, debug records are logged in Debug mode only,
+// and info records are not logged in Silence mode
+func (r *Runner) logEnabled(level Level) bool {
+	switch level {
+	case LevelDebug:
+		return r.Debug
+	case LevelInfo:
+		return !r.Silence
+	}
+	return true
+}
+
+func (r *Runner) log(level Level, msg string, fields ...Field) {
+	if r.logEnabled(level) {
+		r.logger().Log(level, msg, fields...)
+	}
+}
+
+// log a record with fields of current step, gpg file, section and gp file,
+// fields of the same keys in fields take place of them
+func (this *gopgProcessor) log(level Level, msg string, fields ...Field) {
+	if !this.runner.logEnabled(level) {
+		return
+	}
+	all := []Field{{"step", this.step.Name()}, {"gpg", relateGoPath(this.runner.fsys, this.gpgPath)}}
+	if this.section != "" {
+		all = append(all, Field{"section", this.section})
+	}
+	if this.gpPath != "" {
+		all = append(all, Field{"gp", relateGoPath(this.runner.fsys, this.gpPath)})
+	}
+	for _, f := range fields {
+		i := 0
+		for i < len(all) && all[i].Key != f.Key {
+			i++
+		}
+		if i < len(all) {
+			all[i] = f
+		} else {
+			all = append(all, f)
+		}
+	}
+	this.logger.Log(level, msg, all...)
+}
@@ -0,0 +1,125 @@
+package gogp
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testLogger keeps records in memory
+type testLogger struct {
+	lock    sync.Mutex
+	records []logRecord
+}
+
+func (l *testLogger) Log(level Level, msg string, fields ...Field) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.records = append(l.records, logRecord{level, msg, fields})
+}
+
+func (l *testLogger) find(msg string) *logRecord {
+	for i := range l.records {
+		if l.records[i].msg == msg {
+			return &l.records[i]
+		}
+	}
+	return nil
+}
+
+func TestLoggerFormat(t *testing.T) {
+	var b strings.Builder
+	l := NewTextLogger(&b)
+	l.Log(LevelWarn, "maybe lost key", Field{"gpg", "a.gpg"}, Field{"key", "K V"}, Field{"empty", ""})
+	l.Log(LevelInfo, "working at", Field{"path", "demo"})
+	if want := "[gogp warn]: maybe lost key gpg=a.gpg key=\"K V\" empty=\"\"\n[gogp] working at path=demo\n"; b.String() != want {
+		t.Fatalf("got %q\nwant %q", b.String(), want)
+	}
+
+	b.Reset()
+	l = NewJSONLogger(&b)
+	l.Log(LevelError, "failed", Field{"section", "s\"1"}, Field{"n", 2}, Field{"err", errors.New("bad")})
+	if want := `{"level":"error","msg":"failed","section":"s\"1","n":2,"err":"bad"}` + "\n"; b.String() != want {
+		t.Fatalf("got %q\nwant %q", b.String(), want)
+	}
+}
+
+func TestRunnerLogger(t *testing.T) {
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/demo/box.gp":  tstGpBox + "\n//<NO_SUCH_KEY>\n//#GOGP_ONCE\nconst once = 1\n//#GOGP_END_ONCE\n",
+		"/app/demo/box.gpg": "[box_int]\nGOGP_GpFilePath=box\nPACKAGE=package demo\nVALUE_TYPE=int\nGLOBAL_NAME_PREFIX=Int\n",
+	})
+	l := &testLogger{}
+	if _, err := NewRunner(Config{Silence: true, FS: fsys, Logger: l, NoCache: true}).Work("/app"); err != nil {
+		t.Fatal(err)
+	}
+	r := l.find("key has no replacing")
+	want := []Field{{"step", "produce"}, {"gpg", "/app/demo/box.gpg"}, {"section", "box_int"}, {"gp", "/app/demo/box.gp"}, {"line", 15}, {"col", 3}, {"key", "<NO_SUCH_KEY>"}}
+	if r == nil || r.level != LevelError || !reflect.DeepEqual(r.fields, want) {
+		t.Fatalf("records: %v", l.records)
+	}
+	if l.find("working at") != nil || l.find("#GOGP_ONCE ok") != nil {
+		t.Fatalf("info and debug records should not be logged: %v", l.records)
+	}
+
+	l = &testLogger{}
+	if _, err := NewRunner(Config{FS: fsys, Logger: l, Debug: true, NoCache: true}).Work("/app"); err != nil {
+		t.Fatal(err)
+	}
+	if r := l.find("working at"); r == nil || r.level != LevelInfo || l.find("#GOGP_ONCE ok") == nil {
+		t.Fatalf("records: %v", l.records)
+	}
+}
+
+func TestRunnerLoggerParallel(t *testing.T) {
+	files := map[string]string{}
+	for _, d := range []string{"a", "b", "c", "d", "e"} {
+		files["/app/"+d+"/box.gp"] = tstGpBox
+		files["/app/"+d+"/box.gpg"] = tstGpgBox
+	}
+	var logs [2]testLogger
+	for i, jobs := range []int{1, 4} {
+		if _, err := NewRunner(Config{FS: NewMemFileSystem(files), Logger: &logs[i], Jobs: jobs}).Work("/app"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(logs[0].records) != 16 || !reflect.DeepEqual(logs[0].records, logs[1].records) {
+		t.Fatalf("serial=%v\nparallel=%v", logs[0].records, logs[1].records)
+	}
+}
+
+func TestLogSectionsInRow(t *testing.T) {
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/demo/box.gp":  tstGpBox,
+		"/app/demo/cup.gp":  strings.Replace(tstGpBox, "Box", "Cup", -1),
+		"/app/demo/box.gpg": tstGpgBox + "\n[cup_int]\nGOGP_GpFilePath=cup\nPACKAGE=package demo\nVALUE_TYPE=int\nGLOBAL_NAME_PREFIX=Int\n",
+	})
+	l := &testLogger{}
+	if _, err := NewRunner(Config{FS: fsys, Logger: l, NoCache: true, Steps: []Step{StepProduce}}).Work("/app"); err != nil {
+		t.Fatal(err)
+	}
+	var sections []string
+	for _, r := range l.records {
+		if r.msg != "processing section" {
+			continue
+		}
+		for _, f := range r.fields {
+			switch f.Key {
+			case "section":
+				sections = append(sections, f.Value.(string))
+			case "gp":
+				t.Errorf("gp of last section is logged: %v", r)
+			}
+		}
+	}
+	if !reflect.DeepEqual(sections, []string{"box_int", "box_string", "cup_int"}) {
+		t.Fatalf("records: %v", l.records)
+	}
+	for _, file := range []string{"/app/demo/box.gp_int.go", "/app/demo/cup.gp_int.go"} {
+		if _, err := fsys.Stat(file); err != nil {
+			t.Errorf("%s: %v", file, err)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gogp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gogp/ini"
+)
+
+const manifestName = "manifest" //manifest file in dataDir
+
+// kinds of files in manifest
+const (
+	kindProduct = "product" //code file generated from gp file
+	kindGp      = "gp"      //gp file reversed from fake go file
+	kindFake    = "fake"    //fake go file that #GOGP_REQUIRE and file marks are expanded in, it is never pruned
+)
+
+// source of a file that gogp has written
+type manifestEntry struct {
+	Kind    string `json:"kind"`
+	Gpg     string `json:"gpg"`
+	Section string `json:"section"`
+	Gp      string `json:"gp,omitempty"` //gp file of product, or fake go file of gp file
+}
+
+// manifest records every file gogp has written under a root, and where it comes from,
+// so files that are no longer produced can be pruned.
+type manifest struct {
+	Version string                    `json:"version"`
+	Files   map[string]*manifestEntry `json:"files"` //file path => source
+
+	file  string //path of manifest file
+	dirty bool   //manifest has been changed
+}
+
+// load manifest file, an empty manifest is returned if it does not exist or is broken
+func loadManifest(fsys FileSystem, file string) *manifest {
+	m := &manifest{}
+	if b, err := fsys.ReadFile(file); err == nil && json.Unmarshal(b, m) != nil {
+		m = &manifest{dirty: true}
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]*manifestEntry)
+	}
+	m.Version, m.file = libVersion, file
+	return m
+}
+
+// set source of file, or delete it if e is nil
+func (m *manifest) set(file string, e *manifestEntry) {
+	old, ok := m.Files[file]
+	switch {
+	case e == nil && !ok, e != nil && ok && *old == *e:
+		return
+	case e == nil:
+		delete(m.Files, file)
+	default:
+		m.Files[file] = e
+	}
+	m.dirty = true
+}
+
+// save manifest file if it has been changed
+func (m *manifest) save(fsys FileSystem) error {
+	if !m.dirty {
+		return nil
+	}
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err == nil {
+		if err = fsys.WriteFile(m.file, append(b, '\n')); err == nil {
+			m.dirty = false
+		}
+	}
+	return err
+}
+
+// get manifest entry of a report entry
+func newManifestEntry(e *ReportEntry) *manifestEntry {
+	m := &manifestEntry{Kind: kindProduct, Gpg: e.Gpg, Section: e.Section, Gp: e.Gp}
+	switch {
+	case filepath.Ext(e.Target) == gpExt:
+		m.Kind = kindGp
+	case e.Gp == "":
+		m.Kind = kindFake
+	}
+	return m
+}
+
+// open manifest of root of dir for this run
+func (r *Runner) openManifest(dir string) {
+	base := r.fileSystem()
+	r.manifest = loadManifest(base, filepath.ToSlash(filepath.Join(dataRoot(base, dir), dataDir, manifestName)))
+}
+
+// record files written or removed by this run in manifest and save it,
+// nothing is recorded if files are kept in memory
+func (r *Runner) closeManifest(rpt *Report) {
+	if r.manifest == nil || r.inMemory() {
+		return
+	}
+	for _, e := range rpt.Entries {
+		switch {
+		case e.Target == "":
+		case e.Status == StatusRemoved, e.Status == StatusSkipped && r.RemoveProductsOnly:
+			r.manifest.set(e.Target, nil)
+		case e.Status == StatusWritten, e.Status == StatusSkipped:
+			r.manifest.set(e.Target, newManifestEntry(e))
+		}
+	}
+	if err := r.manifest.save(r.fileSystem()); err != nil {
+		r.log(LevelWarn, "save manifest failed", Field{"path", relateGoPath(r.fsys, r.manifest.file)}, Field{"err", err})
+	}
+}
+
+// check if content is generated by gogp by the mark of its head, gp files have the head in an ignore block
+func isGenerated(content string) bool {
+	return strings.HasPrefix(content, txtGeneratedMark) || strings.HasPrefix(content, "//#GOGP_IGNORE_BEGIN\n"+txtGeneratedMark)
+}
+
+// Prune removes files generated by gogp under dir that are no longer produced,
+// like products of sections that have been deleted or renamed, and those of removed gpg files.
+// Generated files are found by the manifest in .gogp/manifest of module root(or the working path),
+// and by the generated mark and provenance of their heads.
+// A file is removed only if its gpg file has been processed by this run without producing it,
+// or its gpg file or section no longer exists, so products of excluded gpg files are kept,
+// and so are generated files that do not tell where they come from.
+// Products modified by hand are not removed unless ForceUpdate is set.
+// If any gpg, section or product fails, nothing is pruned since products of it are unknown.
+func (r *Runner) Prune(dir string) (rpt *Report, err error) {
+	if _, _, ok := splitTarget(dir); ok {
+		return nil, fmt.Errorf("prune works on dirs only, not [%s]", dir)
+	}
+	c := NewRunner(r.Config)
+	c.Config.CheckOnly, c.Config.DryRun = true, false
+	c.Config.ForceUpdate, c.Config.RemoveProductsOnly = false, false
+	var cur *Report
+	if cur, err = c.Work(dir); err != nil {
+		return
+	}
+
+	start := time.Now()
+	r.reset()
+	dirs := r.workDirs(dir)
+	rpt = &Report{Dir: formatPath(dirs[0]), InMemory: r.inMemory(), Gpgs: cur.Gpgs, fsys: r.fsys}
+	r.lockRoots(dirs...)
+	r.openManifest(dirs[0])
+
+	processed := make(map[string]bool)
+	for _, gpg := range cur.Gpgs {
+		processed[formatPath(gpg)] = true
+	}
+	produced := make(map[string]bool)
+	for _, e := range cur.Entries {
+		switch {
+		case e.Status == StatusWritten, e.Status == StatusSkipped:
+			produced[e.Target] = true
+		case errors.Is(e.Err, ErrModified): //it is still produced
+			produced[e.Target] = true
+		case e.Status == StatusFailed:
+			rpt.add(e)
+		}
+	}
+	if rpt.Count(StatusFailed) == 0 {
+		err = r.prune(dirs, processed, produced, rpt)
+	}
+	r.finish(start, rpt)
+	return
+}
+
+// remove generated files under dirs that are not produced, and whose source is processed or gone
+func (r *Runner) prune(dirs []string, processed, produced map[string]bool, rpt *Report) error {
+	files := make(map[string]*manifestEntry)
+	w := &walker{fsys: r.fsys, patterns: r.Excludes, warn: r.walkWarning}
+	for _, dir := range dirs {
+		dir = formatPath(dir)
+		l, err := w.collect(dir)
+		if err != nil {
+			return err
+		}
+		for _, f := range l {
+			f = formatPath(f) //the same form as targets of report, which is slashed
+			if ext := filepath.Ext(f); ext != gpExt && ext != r.codeExt() || produced[f] {
+				continue
+			}
+			if _, ok := r.manifest.Files[f]; ok {
+				continue
+			}
+			if info, err := r.Provenance(f); info != nil && r.orphan(processed, formatPath(info.Gpg), info.Section) {
+				files[f] = &manifestEntry{Gpg: formatPath(info.Gpg), Section: info.Section, Gp: formatPath(info.Source)}
+			} else if info == nil && err != nil && !errors.Is(err, ErrNoProvenance) && !os.IsNotExist(err) {
+				r.log(LevelWarn, "read generated file failed", Field{"path", relateGoPath(r.fsys, f)}, Field{"err", err})
+			}
+		}
+		for f, e := range r.manifest.Files {
+			if e.Kind != kindFake && !produced[f] && strings.HasPrefix(f, dir+"/") && r.orphan(processed, e.Gpg, e.Section) {
+				files[f] = e
+			}
+		}
+	}
+
+	list := make([]string, 0, len(files))
+	for f := range files {
+		list = append(list, f)
+	}
+	sort.Strings(list)
+	for _, f := range list {
+		e := files[f]
+		entry := &ReportEntry{Step: StepPrune, Gpg: e.Gpg, Section: e.Section, Gp: e.Gp, Target: f, Status: StatusRemoved}
+		b, err := r.readFile(f)
+		if err == nil && !r.ForceUpdate && isModified(string(b)) {
+			err = fmt.Errorf("%w, run with -force to remove it", ErrModified)
+		} else if err == nil {
+			if err = r.removeFile(f); err != nil && !os.IsNotExist(err) {
+				err = saveFileError(err)
+			}
+		}
+		switch {
+		case os.IsNotExist(err): //it has been removed
+			r.manifest.set(f, nil)
+			continue
+		case err != nil:
+			entry.Status = StatusFailed
+			entry.Err = &ProcessError{Step: StepPrune, Gpg: e.Gpg, Section: e.Section, Gp: e.Gp, Target: f, Err: err}
+		}
+		rpt.add(entry)
+	}
+	return nil
+}
+
+// check if a generated file of section of gpg file that is not produced by this run is an orphan,
+// which means gpg file is processed by this run, or gpg file or section no longer exists
+func (r *Runner) orphan(processed map[string]bool, gpg, section string) bool {
+	if processed[gpg] {
+		return true
+	}
+	b, err := r.readFile(gpg)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	f, err := ini.Parse(relateGoPath(r.fsys, gpg), bytes.NewReader(b))
+	return err == nil && f.Keys(section) == nil
+}
+
+// Prune removes files generated by gogp under dir that are no longer produced.
+// See Runner.Prune for details.
+func Prune(dir string) (*Report, error) {
+	return NewRunner(defaultConfig).Prune(dir)
+}
@@ -0,0 +1,156 @@
+package gogp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	const (
+		stale   = "/app/demo/box.gp_string.go"
+		stray   = "/app/old/box.gp_int.go"
+		unknown = "/app/old/list.gp_int.go"
+		fake    = "/app/old/list.go"
+	)
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/demo/box.gp":  tstGpBox,
+		"/app/demo/box.gpg": tstGpgBox,
+		"/app/old/box.gp":   tstGpBox,
+		"/app/old/box.gpg":  tstGpgBox,
+		unknown:             txtGeneratedMark + "\n\npackage old\n",
+		fake:                "package old\n",
+	})
+	cfg := Config{Silence: true, FS: fsys, NoCache: true}
+	if r, err := NewRunner(cfg).Work("/app"); err != nil || r.Err() != nil {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+	m := loadManifest(fsys, "/app/.gogp/manifest")
+	if e := m.Files[stale]; e == nil || e.Kind != kindProduct || e.Section != "box_string" || e.Gpg != "/app/demo/box.gpg" {
+		t.Fatalf("manifest: %#v", m.Files)
+	}
+
+	//products of old gpg file are found by their provenance if they are not in manifest
+	fsys.Remove("/app/old/box.gpg")
+	m.set(stray, nil)
+	m.set("/app/old/box.gp_string.go", nil)
+	m.save(fsys)
+
+	//section box_string is deleted
+	fsys.WriteFile("/app/demo/box.gpg", []byte(strings.Split(tstGpgBox, "[box_string]")[0]))
+
+	cfg.DryRun = true
+	r, err := NewRunner(cfg).Prune("/app")
+	if err != nil || r.Err() != nil || len(r.Changes) != 3 || r.Count(StatusRemoved) != 3 {
+		t.Fatalf("err=%v changes=%v entries=%v", err, r.Changes, r.Entries)
+	}
+	if _, err := fsys.Stat(stale); err != nil {
+		t.Fatal("dry run should not remove anything")
+	}
+
+	//orphan modified by hand
+	b, _ := fsys.ReadFile(stale)
+	fsys.WriteFile(stale, append(b, "//edited\n"...))
+	cfg.DryRun = false
+	if r, err = NewRunner(cfg).Prune("/app"); err != nil || !errors.Is(r.Err(), ErrModified) || r.Count(StatusRemoved) != 2 {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+	if _, err := fsys.Stat(stale); err != nil {
+		t.Fatal("modified product should not be removed")
+	}
+	for _, f := range []string{fake, unknown} {
+		if _, err := fsys.Stat(f); err != nil {
+			t.Fatalf("%s should not be removed: %v", f, err)
+		}
+	}
+
+	cfg.ForceUpdate = true
+	if r, err = NewRunner(cfg).Prune("/app"); err != nil || r.Err() != nil || len(r.Entries) != 1 || r.Entries[0].Section != "box_string" {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+	for _, f := range []string{stale, stray} {
+		if _, err := fsys.Stat(f); err == nil {
+			t.Fatalf("%s should be removed", f)
+		}
+	}
+	if m = loadManifest(fsys, "/app/.gogp/manifest"); m.Files[stale] != nil || m.Files["/app/demo/box.gp_int.go"] == nil {
+		t.Fatalf("manifest: %#v", m.Files)
+	}
+
+	if _, err = NewRunner(cfg).Prune("/app/demo/box.gpg"); err == nil {
+		t.Fatal("prune of gpg file should fail")
+	}
+}
+
+func TestPruneKeepsUnknownProducts(t *testing.T) {
+	products := []string{"/app/demo/box.gp_int.go", "/app/demo/box.gp_string.go", "/app/lib/box.gp_int.go", "/app/lib/box.gp_string.go"}
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/demo/box.gp":  tstGpBox,
+		"/app/demo/box.gpg": tstGpgBox,
+		"/app/lib/box.gp":   tstGpBox,
+		"/app/lib/box.gpg":  tstGpgBox,
+	})
+	cfg := Config{Silence: true, FS: fsys, NoCache: true}
+	if r, err := NewRunner(cfg).Work("/app"); err != nil || r.Err() != nil {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+	keep := func(cfg Config, failed int) {
+		t.Helper()
+		r, err := NewRunner(cfg).Prune("/app")
+		if err != nil || len(r.Failed()) != failed || r.Count(StatusRemoved) != 0 {
+			t.Fatalf("err=%v entries=%v", err, r.Entries)
+		}
+		for _, f := range products {
+			if _, err := fsys.Stat(f); err != nil {
+				t.Fatalf("%s should not be removed: %v", f, err)
+			}
+		}
+	}
+
+	//products of excluded gpg file
+	keep(Config{Silence: true, FS: fsys, NoCache: true, Excludes: []string{"lib"}}, 0)
+
+	//a section fails, products of the other sections are unknown
+	fsys.WriteFile("/app/demo/box.gpg", []byte(strings.Replace(tstGpgBox, "GLOBAL_NAME_PREFIX=String", "", 1)))
+	keep(cfg, 1)
+}
+
+// rawWalkFS walks with paths that are not formatted, like "/app/./demo/box.gp_int.go"
+type rawWalkFS struct {
+	*MemFileSystem
+}
+
+func (f rawWalkFS) Walk(root string, fn filepath.WalkFunc) error {
+	return f.MemFileSystem.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if path != root {
+			path = strings.Replace(path, "/demo", "/./demo", 1)
+		}
+		return fn(path, info, err)
+	})
+}
+
+func (f rawWalkFS) Stat(name string) (os.FileInfo, error) {
+	return f.MemFileSystem.Stat(filepath.Clean(name))
+}
+
+func TestPruneWalkedPaths(t *testing.T) {
+	fsys := rawWalkFS{NewMemFileSystem(map[string]string{
+		"/app/demo/box.gp":  tstGpBox,
+		"/app/demo/box.gpg": tstGpgBox,
+	})}
+	cfg := Config{Silence: true, FS: fsys, NoCache: true}
+	if r, err := NewRunner(cfg).Work("/app"); err != nil || r.Err() != nil {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+	r, err := NewRunner(cfg).Prune("/app")
+	if err != nil || r.Err() != nil || len(r.Entries) != 0 {
+		t.Fatalf("live products should not be pruned: err=%v entries=%v", err, r.Entries)
+	}
+	for _, f := range []string{"/app/demo/box.gp_int.go", "/app/demo/box.gp_string.go"} {
+		if _, err := fsys.MemFileSystem.Stat(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
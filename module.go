@@ -0,0 +1,404 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gogp
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	goModFile  = "go.mod"
+	goWorkFile = "go.work"
+)
+
+// modFile is a parsed go.mod or go.work file
+type modFile struct {
+	dir      string            //dir of the file
+	module   string            //module path, empty for go.work
+	requires map[string]string //module path -> version
+	replaces []modReplace      //replace directives
+	uses     []string          //dirs of use directives, go.work only
+	modTime  time.Time         //to find if the file has been changed
+	size     int64             //to find if the file has been changed
+}
+
+// a replace directive: old [oldVersion] => new [newVersion]
+type modReplace struct {
+	old, oldVersion string
+	new, newVersion string
+}
+
+// parsed files are cached by file system and path
+type modFileKey struct {
+	fsys FileSystem
+	file string
+}
+
+var modFileCache = struct {
+	sync.Mutex
+	files map[modFileKey]*modFile
+}{files: make(map[modFileKey]*modFile)}
+
+// check if work in module mode
+func moduleMode() bool {
+	return os.Getenv("GO111MODULE") != "off"
+}
+
+// load and parse go.mod or go.work, parsed files are cached until they are changed
+func loadModFile(fsys FileSystem, file string) *modFile {
+	info, err := fsys.Stat(file)
+	if err != nil || info.IsDir() {
+		return nil
+	}
+
+	modFileCache.Lock()
+	defer modFileCache.Unlock()
+	key := modFileKey{fsys, file}
+	if f, ok := modFileCache.files[key]; ok && f.modTime.Equal(info.ModTime()) && f.size == info.Size() {
+		return f
+	}
+	b, err := fsys.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	f := parseModFile(string(b))
+	f.dir = filepath.Dir(file)
+	f.modTime, f.size = info.ModTime(), info.Size()
+	modFileCache.files[key] = f
+	return f
+}
+
+// parse go.mod or go.work, only directives that gogp cares about are kept
+func parseModFile(content string) *modFile {
+	f := &modFile{requires: make(map[string]string)}
+	block := "" //verb of current block, eg: require ( ... )
+	for _, line := range strings.Split(content, "\n") {
+		args := splitModLine(line)
+		if len(args) == 0 {
+			continue
+		}
+		if block != "" {
+			if args[0] == ")" {
+				block = ""
+				continue
+			}
+			args = append([]string{block}, args...)
+		} else if len(args) == 2 && args[1] == "(" {
+			block = args[0]
+			continue
+		}
+
+		switch verb, args := args[0], args[1:]; verb {
+		case "module":
+			if len(args) > 0 {
+				f.module = args[0]
+			}
+		case "require":
+			if len(args) >= 2 {
+				f.requires[args[0]] = args[1]
+			}
+		case "use":
+			if len(args) > 0 {
+				f.uses = append(f.uses, args[0])
+			}
+		case "replace":
+			if r, ok := parseModReplace(args); ok {
+				f.replaces = append(f.replaces, r)
+			}
+		}
+	}
+	return f
+}
+
+// parse args of replace directive: old [oldVersion] => new [newVersion]
+func parseModReplace(args []string) (r modReplace, ok bool) {
+	for i, arg := range args {
+		if arg != "=>" {
+			continue
+		}
+		left, right := args[:i], args[i+1:]
+		if len(left) == 0 || len(left) > 2 || len(right) == 0 || len(right) > 2 {
+			return
+		}
+		r.old, r.new = left[0], right[0]
+		if len(left) == 2 {
+			r.oldVersion = left[1]
+		}
+		if len(right) == 2 {
+			r.newVersion = right[1]
+		}
+		return r, true
+	}
+	return
+}
+
+// split a line of go.mod into words, comments are removed and quoted words are unquoted
+func splitModLine(line string) (words []string) {
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+		if strings.HasPrefix(line, "//") {
+			break
+		}
+		end := strings.IndexAny(line, " \t")
+		switch line[0] {
+		case '`':
+			if i := strings.IndexByte(line[1:], '`'); i >= 0 {
+				end = i + 2
+			}
+		case '"':
+			for i := 1; i < len(line); i++ {
+				if line[i] == '\\' {
+					i++
+				} else if line[i] == '"' {
+					end = i + 1
+					break
+				}
+			}
+		}
+		if end < 0 {
+			end = len(line)
+		}
+		w := line[:end]
+		if u, err := strconv.Unquote(w); err == nil {
+			w = u
+		}
+		words = append(words, w)
+		line = line[end:]
+	}
+	return
+}
+
+// find file name in dir and its parents
+func findUpFile(fsys FileSystem, dir, name string) string {
+	for dir = filepath.Clean(dir); ; {
+		file := filepath.Join(dir, name)
+		if info, err := fsys.Stat(file); err == nil && !info.IsDir() {
+			return file
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// find go.mod of main module that dir belongs to
+func findGoMod(fsys FileSystem, dir string) *modFile {
+	if !moduleMode() {
+		return nil
+	}
+	if file := findUpFile(fsys, dir, goModFile); file != "" {
+		return loadModFile(fsys, file)
+	}
+	return nil
+}
+
+// find go.work of workspace that dir belongs to, GOWORK is respected
+func findGoWork(fsys FileSystem, dir string) *modFile {
+	if !moduleMode() {
+		return nil
+	}
+	switch gowork := os.Getenv("GOWORK"); {
+	case gowork == "off":
+		return nil
+	case gowork != "":
+		return loadModFile(fsys, gowork)
+	}
+	if file := findUpFile(fsys, dir, goWorkFile); file != "" {
+		return loadModFile(fsys, file)
+	}
+	return nil
+}
+
+// get local dir of a replacement path, or "" if it is a module path
+func (f *modFile) localDir(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	if path == "." || path == ".." || strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../") {
+		return filepath.Join(f.dir, path)
+	}
+	return ""
+}
+
+// get dirs of use directives
+func (f *modFile) useDirs() (dirs []string) {
+	for _, use := range f.uses {
+		if filepath.IsAbs(use) {
+			dirs = append(dirs, filepath.Clean(use))
+		} else {
+			dirs = append(dirs, filepath.Join(f.dir, use))
+		}
+	}
+	return
+}
+
+// add replace directives to modules
+func (f *modFile) replace(modules map[string]string) {
+	for _, r := range f.replaces {
+		if r.oldVersion != "" && f.requires[r.old] != "" && f.requires[r.old] != r.oldVersion {
+			continue //replace another version
+		}
+		if dir := f.localDir(r.new); dir != "" {
+			modules[r.old] = dir
+		} else if r.newVersion != "" {
+			modules[r.old] = moduleCacheDir(r.new, r.newVersion)
+		}
+	}
+}
+
+// get dirs of all modules that can be seen from dir, module path -> dir
+func visibleModules(fsys FileSystem, dir string) map[string]string {
+	modules := make(map[string]string)
+	var mains []*modFile
+	work := findGoWork(fsys, dir)
+	if work != nil {
+		for _, dir := range work.useDirs() {
+			if f := loadModFile(fsys, filepath.Join(dir, goModFile)); f != nil {
+				mains = append(mains, f)
+			}
+		}
+	} else if f := findGoMod(fsys, dir); f != nil {
+		mains = append(mains, f)
+	}
+
+	for _, f := range mains {
+		for path, version := range f.requires {
+			modules[path] = moduleCacheDir(path, version)
+		}
+	}
+	for _, f := range mains {
+		f.replace(modules)
+	}
+	if work != nil { //replace directives of go.work override go.mod
+		work.replace(modules)
+	}
+	for _, f := range mains {
+		if f.module != "" {
+			modules[f.module] = f.dir
+		}
+	}
+	return modules
+}
+
+// resolve an import-path-like file path in module mode, it returns "" if no module matches.
+// The longest module path which is a prefix of path wins, just like go build.
+func resolveModulePath(fsys FileSystem, fromDir, path string) string {
+	path = filepath.ToSlash(path)
+	best, bestDir := "", ""
+	for mod, dir := range visibleModules(fsys, fromDir) {
+		if (path == mod || strings.HasPrefix(path, mod+"/")) && len(mod) > len(best) {
+			best, bestDir = mod, dir
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return filepath.Join(bestDir, filepath.FromSlash(strings.TrimPrefix(path, best)))
+}
+
+// resolve an import-path-like file path related to dir.
+// Modules are tried first, then every entry of GOPATH.
+// If the file is not found, path related to the first module or GoPath is returned.
+func resolveImportPath(fsys FileSystem, fromDir, path string) string {
+	var candidates []string
+	if p := resolveModulePath(fsys, fromDir, path); p != "" {
+		candidates = append(candidates, p)
+	}
+	for _, src := range goPathList() {
+		candidates = append(candidates, filepath.Join(src, path))
+	}
+	for _, p := range candidates {
+		if _, err := fsys.Stat(p); err == nil {
+			return p
+		}
+	}
+	return candidates[0]
+}
+
+// get dir of module in module cache
+func moduleCacheDir(path, version string) string {
+	cache := os.Getenv("GOMODCACHE")
+	if cache == "" {
+		cache = filepath.Join(goPathRoot(), "pkg", "mod")
+	}
+	return filepath.Join(cache, filepath.FromSlash(escapeModulePath(path)+"@"+escapeModulePath(version)))
+}
+
+// escape upper case letters of module path as module cache does, eg: "Azure" -> "!azure"
+func escapeModulePath(path string) string {
+	var b strings.Builder
+	for _, c := range path {
+		if 'A' <= c && c <= 'Z' {
+			b.WriteByte('!')
+			c += 'a' - 'A'
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// get module related path of a file, such as "github.com/gxlb/gogp/examples/stack.gp"
+// go.mod is looked up in fsys, which is the file system of the run, or OS file system if it is nil.
+func relateModule(fsys FileSystem, file string) (string, bool) {
+	if fsys == nil {
+		fsys = OSFileSystem{}
+	}
+	if f := findGoMod(fsys, filepath.Dir(file)); f != nil && f.module != "" {
+		if rel, err := filepath.Rel(f.dir, file); err == nil {
+			return f.module + "/" + filepath.ToSlash(rel), true
+		}
+	}
+	return "", false
+}
+
+// get dirs to work on by default.
+// In module mode, they are the workspace dir or main module dir of working path,
+// use dirs of workspace out of workspace dir are also included.
+// Otherwise it is GoPath.
+func defaultWorkDirs(fsys FileSystem) []string {
+	wd := workPath()
+	if work := findGoWork(fsys, wd); work != nil {
+		dirs := []string{work.dir}
+		for _, dir := range work.useDirs() {
+			if rel, err := filepath.Rel(work.dir, dir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				dirs = append(dirs, dir)
+			}
+		}
+		return dirs
+	}
+	if f := findGoMod(fsys, wd); f != nil {
+		return []string{f.dir}
+	}
+	return []string{goPath}
+}
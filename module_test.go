@@ -0,0 +1,150 @@
+package gogp
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testSetenv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestParseModFile(t *testing.T) {
+	f := parseModFile(`module "example.com/app" // comment
+
+go 1.15
+
+require example.com/a v1.0.0
+require (
+	example.com/b v1.1.0 // indirect
+	example.com/c v1.2.0
+)
+
+replace example.com/a => ../a
+replace (
+	example.com/b v1.1.0 => example.com/fork/b v1.1.1
+)
+use ./x
+`)
+	if f.module != "example.com/app" {
+		t.Errorf("module=%q", f.module)
+	}
+	wantReq := map[string]string{"example.com/a": "v1.0.0", "example.com/b": "v1.1.0", "example.com/c": "v1.2.0"}
+	if !reflect.DeepEqual(f.requires, wantReq) {
+		t.Errorf("requires=%v", f.requires)
+	}
+	wantRep := []modReplace{
+		{old: "example.com/a", new: "../a"},
+		{old: "example.com/b", oldVersion: "v1.1.0", new: "example.com/fork/b", newVersion: "v1.1.1"},
+	}
+	if !reflect.DeepEqual(f.replaces, wantRep) {
+		t.Errorf("replaces=%v", f.replaces)
+	}
+	if !reflect.DeepEqual(f.uses, []string{"./x"}) {
+		t.Errorf("uses=%v", f.uses)
+	}
+}
+
+func TestEscapeModulePath(t *testing.T) {
+	if s := escapeModulePath("github.com/Azure/azure-sdk"); s != "github.com/!azure/azure-sdk" {
+		t.Errorf("got %s", s)
+	}
+}
+
+func TestResolveImportPath(t *testing.T) {
+	root := t.TempDir()
+	testSetenv(t, "GO111MODULE", "")
+	testSetenv(t, "GOWORK", "")
+	testSetenv(t, "GOMODCACHE", filepath.Join(root, "modcache"))
+	testGoPath(t, map[string]string{"example.com/old/box.gp": tstGpBox})
+
+	files := map[string]string{
+		"app/go.mod":     "module example.com/app\n\nrequire (\n\texample.com/tpl v1.0.0\n\texample.com/Lib v1.2.0\n)\n\nreplace example.com/tpl => ../tpl\n",
+		"app/tpl/box.gp": tstGpBox,
+		"tpl/go.mod":     "module example.com/tpl\n",
+		"tpl/box.gp":     tstGpBox,
+		"modcache/example.com/!lib@v1.2.0/box.gp": tstGpBox,
+	}
+	for name, content := range files {
+		testWriteFile(t, filepath.Join(root, name), content)
+	}
+
+	from := filepath.Join(root, "app", "demo")
+	cases := map[string]string{
+		"example.com/app/tpl/box.gp": filepath.Join(root, "app", "tpl", "box.gp"),
+		"example.com/tpl/box.gp":     filepath.Join(root, "tpl", "box.gp"),
+		"example.com/Lib/box.gp":     filepath.Join(root, "modcache", "example.com", "!lib@v1.2.0", "box.gp"),
+		"example.com/old/box.gp":     filepath.Join(goPath, "example.com", "old", "box.gp"),
+	}
+	for path, want := range cases {
+		if got := resolveImportPath(OSFileSystem{}, from, path); filepath.Clean(got) != filepath.Clean(want) {
+			t.Errorf("%s: got %s want %s", path, got, want)
+		}
+	}
+
+	//go.work overrides go.mod
+	testWriteFile(t, filepath.Join(root, "go.work"), "go 1.18\n\nuse (\n\t./app\n\t./tpl\n)\n")
+	testWriteFile(t, filepath.Join(root, "app", "go.mod"), "module example.com/app\n")
+	if got, want := resolveImportPath(OSFileSystem{}, from, "example.com/tpl/box.gp"), filepath.Join(root, "tpl", "box.gp"); got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+	if got, want := relateGoPath(nil, filepath.Join(root, "tpl", "box.gp")), "example.com/tpl/box.gp"; got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+}
+
+func TestWorkOnModule(t *testing.T) {
+	root := t.TempDir()
+	testSetenv(t, "GO111MODULE", "")
+	testSetenv(t, "GOWORK", "")
+	files := map[string]string{
+		"app/go.mod":       "module example.com/app\n\nrequire example.com/tpl v1.0.0\n\nreplace example.com/tpl => ../tpl\n",
+		"app/demo/box.gpg": strings.Replace(tstGpgBox, "GOGP_GpFilePath=box", "GOGP_GpFilePath=example.com/tpl/box", -1),
+		"tpl/go.mod":       "module example.com/tpl\n",
+		"tpl/box.gp":       tstGpBox,
+	}
+	for name, content := range files {
+		testWriteFile(t, filepath.Join(root, name), content)
+	}
+
+	r, err := NewRunner(Config{Silence: true}).Work(filepath.Join(root, "app"))
+	if err == nil {
+		err = r.Err()
+	}
+	if err != nil || r.Count(StatusWritten) != 2 {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+	code := testReadFile(t, filepath.Join(root, "app", "demo", "box.gp_int.go"))
+	if !strings.Contains(code, "[../../tpl/box.gp]") {
+		t.Errorf("unexpected code:\n%s", code)
+	}
+}
+
+func TestRelateModuleInMemory(t *testing.T) {
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/go.mod":       "module example.com/app\n",
+		"/app/demo/box.gp":  tstGpBox + "//#GOGP_IFDEF VALUE_TYPE\n",
+		"/app/demo/box.gpg": tstGpgBox,
+	})
+	r, err := NewRunner(Config{Silence: true, FS: fsys}).Work("/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Err(); err == nil || !strings.Contains(err.Error(), "[example.com/app/demo/box.gpg:") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if s := r.Failed()[0].String(); !strings.Contains(s, "[example.com/app/demo/box.gp]") {
+		t.Errorf("unexpected entry: %s", s)
+	}
+}
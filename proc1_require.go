@@ -34,7 +34,11 @@ import (
 )
 
 func (this *gopgProcessor) procStep1Require() (err error) {
-	pathWithName := filepath.Join(filepath.Dir(this.gpgPath), this.getGpName())
+	gpName := ""
+	if gpName, err = this.getGpName(); err != nil {
+		return
+	}
+	pathWithName := filepath.Join(filepath.Dir(this.gpgPath), gpName)
 	codeFilePath := this.getFakeSrcFilePath(pathWithName)
 	this.codePath = codeFilePath
 
@@ -51,17 +55,17 @@ func (this *gopgProcessor) procStep1Require() (err error) {
 		elem := gogpExpRequireAll.FindAllStringSubmatch(src, -1)[0]
 		req, reqp, reqn, reqgpg, content, fileb, open, filee := elem[1], elem[2], elem[3], elem[4], elem[5], elem[6], elem[7], elem[8]
 
-		reqp, reqn, reqgpg, content = reqp, reqn, reqgpg, content //avoid compile error
+		_, _, _, _ = reqp, reqn, reqgpg, content //avoid compile error
 
 		var err error
 		var replaced bool
 		switch {
 		case req != "":
 			if rep, replaced, err = this.procRequireReplacement(src, this.section, 0); err != nil {
-				fmt.Println(err)
+				this.fail("", this.codePath, err)
 			}
 		case fileb != "":
-			if optRemoveProductsOnly {
+			if this.runner.RemoveProductsOnly {
 				rep, replaced = fmt.Sprintf("\n\n%s\n\n", fileb), true
 				break
 			}
@@ -70,7 +74,7 @@ func (this *gopgProcessor) procStep1Require() (err error) {
 				rep = fmt.Sprintf("\n\n%s\n%s", fileb, repContent)
 			}
 		case filee != "":
-			if optRemoveProductsOnly {
+			if this.runner.RemoveProductsOnly {
 				rep, replaced = fmt.Sprintf("\n\n%s\n\n", filee), true
 				break
 			}
@@ -85,18 +89,16 @@ func (this *gopgProcessor) procStep1Require() (err error) {
 		return
 	})
 
-	if optForceUpdate || replcaceCnt > 0 {
+	if this.runner.writeAll() || replcaceCnt > 0 {
 		replacedCode = gogpExpEmptyLine.ReplaceAllString(replacedCode, "\n\n") //avoid multi empty lines
-		replacedCode = goFmt(replacedCode, this.gpPath)
+		if replacedCode, err = goFmt(replacedCode); err != nil {
+			return
+		}
 
-		if err = this.rawSaveFile(this.codePath, replacedCode); err == nil {
-			this.nCodeFile++
-			if !optSilence {
-				fmt.Printf(">>[gogp] %s updated for #GOGP_REQUIRE\n", relateGoPath(this.codePath))
-			}
-		} else {
-			fmt.Println(err)
+		if err = this.rawSaveFile(this.codePath, replacedCode); err != nil {
+			return
 		}
+		this.record(StatusWritten, "", this.codePath)
 	}
 
 	return
@@ -106,14 +108,15 @@ func (this *gopgProcessor) procStep1Require() (err error) {
 func (this *gopgProcessor) procRequireReplacement(statement, section string, nDepth int) (rep string, replaced bool, err error) {
 	rep = statement
 	if nDepth >= 5 {
-		panic(fmt.Sprintf("[gogp error] [%s:%s]maybe loop recursive of #GOGP_REQUIRE(...), %d", relateGoPath(this.gpgPath), section, nDepth))
+		err = this.newError("", "", fmt.Errorf("%w of #GOGP_REQUIRE(...), depth=%d", ErrRequireLoop, nDepth))
+		return
 	}
 
 	elem := gogpExpRequire.FindAllStringSubmatch(statement, -1)[0] //{"", "REQ", "REQP", "REQN","REQGPG","CONTENT"}
 	req, reqp, reqn, reqgpg, content := elem[1], elem[2], elem[3], elem[4], elem[5]
 
-	if debug {
-		fmt.Printf("[gogp debug] #GOGP_REQUIRE: [%s][%s][%s][%s][%s]\n", req, reqp, reqn, reqgpg, content)
+	if this.runner.Debug {
+		this.log(LevelDebug, "#GOGP_REQUIRE", Field{"req", req}, Field{"path", reqp}, Field{"name", reqn}, Field{"gpgKey", reqgpg}, Field{"content", content})
 	}
 
 	if reqgpg != "" && reqn == "" { //section name is config from gpg file
@@ -134,12 +137,15 @@ func (this *gopgProcessor) procRequireReplacement(statement, section string, nDe
 	if replaceSection == "" || replaceSection == "_" {
 		replaceSection = section
 	}
-	gpFullPath := this.getGpFullPath(reqp)
+	gpFullPath := ""
+	if gpFullPath, err = this.getGpFullPath(reqp); err != nil {
+		return
+	}
 	gpContent := ""
 
 	if gpContent, err = this.rawLoadFile(gpFullPath); err == nil {
 		replacedGp := ""
-		if this.step == gogpStepPRODUCE {
+		if this.step == StepProduce {
 			replaced = true
 			if at {
 				rep = "\n" + content + "\n"
@@ -152,9 +158,8 @@ func (this *gopgProcessor) procRequireReplacement(statement, section string, nDe
 				gpName := strings.TrimSuffix(filepath.Base(gpFullPath), gpExt)
 				codePath := this.getProductFilePath(gpgDir, gpName, this.getCodeFileSuffix(replaceSection))
 
-				if optRemoveProductsOnly { //remove products only
-					this.nCodeFile++
-					this.remove(codePath)
+				if this.runner.RemoveProductsOnly { //remove products only
+					this.remove(gpFullPath, codePath)
 					return
 				}
 
@@ -162,36 +167,35 @@ func (this *gopgProcessor) procRequireReplacement(statement, section string, nDe
 					return
 				}
 
-				if _, ok := savedCodeFile[codePath]; ok { //skip saved file
+				if !this.runner.markSaved(codePath) { //skip saved file, to prevent rewrite this file no matter it chages or not
 					return
-				} else {
-					savedCodeFile[codePath] = true //to prevent rewrite this file no matter it chages or not
 				}
 
+				codeContent := this.fileHead(gpFullPath, codePath, replaceSection) + "\n" + replacedGp
+				if codeContent, err = goFmt(codeContent); err != nil {
+					err = this.newError(gpFullPath, codePath, err)
+					return
+				}
+				codeContent = sealProduct(codeContent)
 				oldCode, _ := this.rawLoadFile(codePath)
 
-				if optForceUpdate || !strings.HasSuffix(oldCode, replacedGp) { //body change then save it,else skip it
-					codeContent := this.fileHead(gpFullPath, this.gpgPath, replaceSection) + "\n" + replacedGp
-					codeContent = goFmt(codeContent, codePath)
-					if err = this.rawSaveFile(codePath, codeContent); err == nil {
-						this.nCodeFile++
-						if !optSilence {
-							fmt.Printf(">>[gogp] #GOGP_REQUIRE [%s:%s -> %s] ok\n", relateGoPath(gpFullPath), replaceSection, relateGoPath(codePath))
-						}
+				if this.runner.writeAll() || oldCode != codeContent { //inputs or body change then save it,else skip it
+					if err = this.checkModified(oldCode); err != nil {
+						err = this.newError(gpFullPath, codePath, err)
+						return
 					}
-				} else {
-					this.nSkipCodeFile++
-					if !optSilence {
-						fmt.Printf(">>[gogp] #GOGP_REQUIRE [%s:%s -> %s] skip\n", relateGoPath(gpFullPath), replaceSection, relateGoPath(codePath))
+					if err = this.rawSaveFile(codePath, codeContent); err != nil {
+						err = this.newError(gpFullPath, codePath, err)
+						return
 					}
+					this.record(StatusWritten, gpFullPath, codePath)
+				} else {
+					this.record(StatusSkipped, gpFullPath, codePath)
 				}
 			}
 		} else {
-			if optRemoveProductsOnly {
+			if this.runner.RemoveProductsOnly {
 				rep = fmt.Sprintf("\n\n%s\n\n", req)
-				if !optSilence {
-					fmt.Printf("%#v\n", rep)
-				}
 				replaced = true
 			} else {
 				if nDepth == 0 { //do not let require recursive
@@ -209,7 +213,10 @@ func (this *gopgProcessor) procRequireReplacement(statement, section string, nDe
 
 					oldContent := content
 
-					rep = goFmt(replacedGp, this.gpPath)
+					if rep, err = goFmt(replacedGp); err != nil {
+						err = this.newError(gpFullPath, "", err)
+						return
+					}
 
 					//check if content changed
 					replaced = oldContent == "" || !strings.Contains(rep, oldContent) //|| !strings.Contains(oldContent, "//#GOGP_IGNORE_BEGIN")
@@ -222,10 +229,33 @@ func (this *gopgProcessor) procRequireReplacement(statement, section string, nDe
 		}
 
 	} else {
-		fmt.Printf("[gogp error]: [%s:%s] #GOGP_REQULRE(%s) : %s\n", relateGoPath(this.gpgPath), section, reqp, err.Error())
-		err = nil
+		err = this.newError(gpFullPath, "", fmt.Errorf("#GOGP_REQUIRE(%s): %w", reqp, err))
 		rep = statement
 	}
 
 	return
 }
+
+// a gp file required by #GOGP_REQUIRE, with the section to replace it
+type requiredGp struct {
+	gp      string
+	section string
+}
+
+// find gp files required by #GOGP_REQUIRE in content, section is the section of content
+func (this *gopgProcessor) requiredGpFiles(content, section string) (reqs []requiredGp) {
+	for _, elem := range gogpExpRequire.FindAllStringSubmatch(content, -1) { //{"", "REQ", "REQP", "REQN","REQGPG","CONTENT"}
+		reqp, reqn, reqgpg := elem[2], elem[3], elem[4]
+		if reqgpg != "" && reqn == "" {
+			reqn = this.getGpgCfg(section, reqgpg, false)
+		}
+		reqn = strings.TrimPrefix(strings.TrimPrefix(reqn, "@"), "#")
+		if reqn == "" || reqn == "_" {
+			reqn = section
+		}
+		if gp, err := this.getGpFullPath(reqp); err == nil {
+			reqs = append(reqs, requiredGp{gp: filepath.ToSlash(gp), section: reqn})
+		}
+	}
+	return
+}
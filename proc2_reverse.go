@@ -28,15 +28,17 @@
 package gogp
 
 import (
-	"bufio"
 	"fmt"
-	"os"
 	"path/filepath"
 )
 
 // generate .gp file
 func (this *gopgProcessor) procStep2Reverse() (err error) {
-	pathWithName := filepath.Join(filepath.Dir(this.gpgPath), this.getGpName())
+	gpName := ""
+	if gpName, err = this.getGpName(); err != nil {
+		return
+	}
+	pathWithName := filepath.Join(filepath.Dir(this.gpgPath), gpName)
 	gpFilePath := pathWithName + gpExt
 	codeFilePath := this.getFakeSrcFilePath(pathWithName)
 	this.codePath = codeFilePath
@@ -52,62 +54,49 @@ func (this *gopgProcessor) procStep2Reverse() (err error) {
 
 	if this.buildMatches(this.section, this.gpPath, true, false) {
 		this.matches.sort()
-		replacedCode, norep := this.matches.doReplacing(this.codeContent, this.gpgPath, true)
+		replacedCode, norep, _ := this.matches.doReplacing(this.log, this.codeContent, "", true)
 		this.nNoReplaceMathNum += norep
 
 		replacedCode = gogpExpEmptyLine.ReplaceAllString(replacedCode, "\n\n") //avoid multi empty lines
 
-		if this.nNoReplaceMathNum > 0 { //report error
-			s := fmt.Sprintf("[gogp error]: [%s:%s] not every gp have been replaced\n", relateGoPath(this.gpgPath), this.section)
-			err = fmt.Errorf(s)
-		}
-
 		if err = this.saveGpFile(replacedCode, this.gpPath); err != nil { //save code to file
 			return
 		}
+
+		if this.nNoReplaceMathNum > 0 { //report error
+			err = this.newError(this.gpPath, "", ErrNoReplacing)
+		}
 	} else {
-		err = fmt.Errorf("[gogp error]: [%s] must have [%s] section", relateGoPath(this.gpgPath), txtSectionReverse)
+		err = fmt.Errorf("%w, must have [%s] section", ErrMissingSection, txtSectionReverse)
 	}
 	return
 }
 
 func (this *gopgProcessor) saveGpFile(body, gpFilePath string) (err error) {
 	this.gpPath = gpFilePath
-	if optRemoveProductsOnly { //remove products only
-		this.nCodeFile++
-		this.remove(this.gpPath)
+	if this.runner.RemoveProductsOnly { //remove products only
+		this.remove(this.codePath, this.gpPath)
 		return
 	}
-	if !optForceUpdate && this.loadGpFile(gpFilePath) == nil { //check if need update
-		if this.gpContent == body { //body not change
-			this.nSkipCodeFile++
-			if !optSilence {
-				fmt.Printf(">>[gogp][%s] skip\n", relateGoPath(this.gpPath))
-			}
-			return
-		}
-	}
-
-	var fout *os.File
-	if fout, err = os.OpenFile(this.gpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm); err != nil {
-		return
-	}
-	defer fout.Close()
-
-	wt := bufio.NewWriter(fout)
 	h := fmt.Sprintf(`//#GOGP_IGNORE_BEGIN
 %s//#GOGP_IGNORE_END
 
-`, this.fileHead(this.codePath, this.gpgPath, this.section))
-	wt.WriteString(h)
-	wt.WriteString(body)
-	if err = wt.Flush(); err != nil {
+`, this.fileHead(this.codePath, this.gpPath, this.section))
+	gp := sealProduct(h + body)
+	old, _ := this.rawLoadFile(gpFilePath)
+	if !this.runner.writeAll() && old == gp { //inputs and body not change
+		this.record(StatusSkipped, this.codePath, this.gpPath)
+		return
+	}
+	if err = this.checkModified(old); err != nil {
+		err = this.newError(this.codePath, this.gpPath, err)
 		return
 	}
 
-	this.nCodeFile++
-	if !optSilence {
-		fmt.Printf(">>[gogp][%s] ok\n", relateGoPath(this.gpPath))
+	if err = this.rawSaveFile(this.gpPath, gp); err != nil {
+		return
 	}
+
+	this.record(StatusWritten, this.codePath, this.gpPath)
 	return
 }
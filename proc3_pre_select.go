@@ -28,21 +28,22 @@
 package gogp
 
 import (
-	"fmt"
 	"strings"
 )
 
-// deal with #GOGP_IFDEF and #GOGP_SWITCH for .gp file
-func (this *gopgProcessor) step3PretreatGpCodeSelector(gpContent string, section string) (replaced string) {
+// deal with #GOGP_IFDEF, #GOGP_SWITCH, #GOGP_MAP, #GOGP_IGNORE and #GOGP_GPONLY for .gp file
+// #GOGP_IGNORE blocks are dropped if dropIgnore, otherwise they are replaced with empty lines
+func (this *gopgProcessor) step3PretreatGpCodeSelector(gpPath, gpContent string, section string, dropIgnore bool) (replaced string, err error) {
 	this.maps.clear()
+	this.dropIgnore = dropIgnore
 
-	replaced = gpContent
-	repCnt := 1 //init first loop
-	for depth := 0; repCnt > 0; depth++ {
-		replaced, repCnt = this.pretreatSelector(replaced, section, depth)
+	nodes, err := parseGp(gpPath, gpContent)
+	if err != nil {
+		return gpContent, err
 	}
-
-	return
+	var b strings.Builder
+	this.selectNodes(&b, nodes, section, false)
+	return b.String(), nil
 }
 
 var boolTrueValues = []string{"true", "t", "yes", "y", "1"}
@@ -57,145 +58,98 @@ func parseBoolValue(val string) bool {
 	return false
 }
 
-func (this *gopgProcessor) selectPart(section, sel string, depth int) string {
-	if depth <= maxRecursionDepth {
-		rep, _ := this.pretreatSelector(sel, section, depth+1)
-		return gogpExpComment.ReplaceAllString(rep, "")
-	}
-
-	return gogpExpComment.ReplaceAllString(sel, "")
-}
-
-// " <key> || !<key> || <key> == xxx || <key> != xxx "
-func (this *gopgProcessor) checkCondition(section, condition string, predefKey string) bool {
-	conds := strings.Split(condition, "||")
-	selOk := false
-	for _, cond := range conds {
-		elems := gogpExpCondition.FindAllStringSubmatch(cond, -1)
-		if len(elems) == 0 {
-			fmt.Printf("[gogp error]: [%s:%s %s] condition(%s) not match patten\n", relateGoPath(this.gpgPath), relateGoPath(this.gpPath), section, cond)
-			return false
-		}
-
-		// ["", "NOT", "KEY", "OP","VALUE"]
-		elem := elems[0]
-		not, key, op, value := elem[1], elem[2], elem[3], elem[4]
-
-		condValCheck := (not == "")
-		if s := len(key); s >= 2 && key[0] == '<' && key[s-1] == '>' { // <key> -> key
-			key = key[1 : s-1]
-		}
-
-		cfg := this.getGpgCfg(section, key, false)
-		condResult := false
-		switch {
-		case predefKey != "":
-			if op != "" || value != "" {
-				fmt.Printf("[gogp warn]: [%s:%s %s] condition(%s) unexpected operator [%s, %s]\n", relateGoPath(this.gpgPath), relateGoPath(this.gpPath), section, cond, op, value)
-			}
-			if s := len(predefKey); s >= 2 && predefKey[0] == '<' && predefKey[s-1] == '>' { // <predefKey> -> predefKey
-				predefKey = predefKey[1 : s-1]
+// write selected content of nodes to b, nested #GOGP_ONCE blocks are merged to the outermost one
+func (this *gopgProcessor) selectNodes(b *strings.Builder, nodes []*gpNode, section string, inOnce bool) {
+	for _, node := range nodes {
+		switch tok := node.tok; tok.kind {
+		case tokText:
+			b.WriteString(tok.text)
+		case tokIgnore:
+			if !this.dropIgnore || tok.name != "IGNORE_BEGIN" {
+				b.WriteString("\n\n")
 			}
-			predefVal := this.getGpgCfg(section, predefKey, false)
-			condResult = (predefVal == key)
-
-		case value != "":
-			switch op {
-			case "==":
-				condResult = (cfg == value)
-			case "!=":
-				condResult = (cfg != value)
-			default:
-				fmt.Printf("[gogp error]: [%s:%s %s] condition(%s) undefined operator [%s]\n", relateGoPath(this.gpgPath), relateGoPath(this.gpPath), section, cond, op)
-				condResult = false
-			}
-
-		default:
-			if op != "" {
-				fmt.Printf("[gogp warn]: [%s:%s %s] condition(%s) unexpected operator [%s]\n", relateGoPath(this.gpgPath), relateGoPath(this.gpPath), section, cond, op)
+		case tokMap:
+			this.maps.insert(tok.arg, tok.dst, false)
+			b.WriteString(tok.tail)
+		case tokIf:
+			this.selectByCondition(b, node, section, inOnce)
+		case tokSwitch:
+			this.selectByCases(b, node, section, inOnce)
+		case tokOnce:
+			if inOnce {
+				this.selectNodes(b, node.body, section, true)
+			} else {
+				b.WriteString(tok.text)
+				this.selectNodes(b, node.body, section, true)
+				b.WriteString(node.end.text)
 			}
-			condResult = parseBoolValue(cfg)
 		}
+	}
+}
 
-		if condResult == condValCheck {
-			selOk = true
-			break
-		}
+func (this *gopgProcessor) selectPart(b *strings.Builder, part []*gpNode, section string, inOnce bool) {
+	var sel strings.Builder
+	this.selectNodes(&sel, part, section, inOnce)
+	b.WriteString(gogpExpComment.ReplaceAllString(sel.String(), ""))
+}
+
+// evaluate condition, an operand is compared with value of switchKey if it is not empty,
+// otherwise it is a bool key like "<key>"
+func (this *gopgProcessor) checkCondition(section string, c *condNode, switchKey string) bool {
+	switch c.op {
+	case "||":
+		return this.checkCondition(section, c.x, switchKey) || this.checkCondition(section, c.y, switchKey)
+	case "&&":
+		return this.checkCondition(section, c.x, switchKey) && this.checkCondition(section, c.y, switchKey)
+	case "!":
+		return !this.checkCondition(section, c.x, switchKey)
+	case "==", "!=":
+		return (this.condValue(section, c.x) == c.y.value) == (c.op == "==")
+	}
+	if switchKey != "" {
+		return this.getGpgCfg(section, switchKey, false) == c.name()
 	}
-	return selOk
+	return parseBoolValue(this.condValue(section, c))
 }
 
-func (this *gopgProcessor) selectByCondition(section, cond, t, f string, depth int) string {
-	ret := ""
-	if this.checkCondition(section, cond, "") {
-		ret = this.selectPart(section, t, depth)
-	} else {
-		ret = this.selectPart(section, f, depth)
+// value of an operand, it is the gpg config of a key, or a string itself
+func (this *gopgProcessor) condValue(section string, c *condNode) string {
+	if c.quoted {
+		return c.value
 	}
+	return this.getGpgCfg(section, c.name(), false)
+}
 
-	return ret
+func (this *gopgProcessor) selectByCondition(b *strings.Builder, node *gpNode, section string, inOnce bool) {
+	if this.checkCondition(section, node.tok.cond, "") {
+		this.selectPart(b, node.body, section, inOnce)
+		return
+	}
+	for _, elif := range node.elifs { //the first branch that matches wins
+		if this.checkCondition(section, elif.tok.cond, "") {
+			this.selectPart(b, elif.body, section, inOnce)
+			return
+		}
+	}
+	this.selectPart(b, node.elseBody, section, inOnce)
 }
 
-func (this *gopgProcessor) selectByCases(section, cases string, predefKey string, multiSwitch bool) string {
-	defaultContent := ""
+func (this *gopgProcessor) selectByCases(b *strings.Builder, node *gpNode, section string, inOnce bool) {
+	multiSwitch := node.tok.name == "MULTISWITCH"
+	var defaultCase *gpNode
 	found := false
-	repaced := gogpExpCases.ReplaceAllStringFunc(cases, func(src string) string {
-		if found && !multiSwitch { //ignore the rest cases if has found in one-way switch
-			return ""
-		}
-		elem := gogpExpCases.FindAllStringSubmatch(src, -1)[0]
-		cond, content := elem[1], elem[2]
+	for _, c := range node.cases {
 		switch {
-		case cond == "": //DEFAULT branch
-			defaultContent = content
-		case this.checkCondition(section, cond, predefKey): //CASE branch
+		case found && !multiSwitch: //ignore the rest cases if has found in one-way switch
+			return
+		case c.tok.kind == tokDefault:
+			defaultCase = c
+		case this.checkCondition(section, c.tok.cond, node.tok.arg):
 			found = true
-			return content
+			this.selectNodes(b, c.body, section, inOnce)
 		}
-		return ""
-	})
-	if !found {
-		return defaultContent
 	}
-	return repaced
-}
-
-func (this *gopgProcessor) pretreatSelector(gpContent string, section string, depth int) (replaced string, repCnt int) {
-	if depth > maxRecursionDepth { //limit recursion depth
-		s := fmt.Sprintf("[gogp error]: [%s:%s %s depth=%d] replace recursion too deep\n", relateGoPath(this.gpgPath), relateGoPath(this.gpPath), section, depth)
-		fmt.Errorf("%s", s)
-		return gpContent, 0
+	if !found && defaultCase != nil {
+		this.selectNodes(b, defaultCase.body, section, inOnce)
 	}
-	replaced = gogpExpCodeSelector.ReplaceAllStringFunc(gpContent, func(src string) (rep string) {
-		repCnt++
-		// []string{"", "IGNORE", "GPONLY", "MAPSRC", "MAPDST", "SWITCHKEY", "SWITCHCONTENT", "MULTISWITCHKEY", "MULTISWITCHCONTENT", "IFCOND", "IFT", "IFF", "IFCOND2", "IFT2", "IFF2"}
-		elem := gogpExpCodeSelector.FindAllStringSubmatch(src, -1)[0]
-		ignore, gponly, mapK, mapV, switchKey, switchCases, multiswitchKey, multiswitchCases, condk, condHit, condMiss, condk2, condHit2, condMiss2 :=
-			elem[1], elem[2], elem[3], elem[4], elem[5], elem[6], elem[7], elem[8], elem[9], elem[10], elem[11], elem[12], elem[13], elem[14]
-
-		switch {
-		case condk != "":
-			rep = this.selectByCondition(section, condk, condHit, condMiss, depth)
-
-		case condk2 != "":
-			rep = this.selectByCondition(section, condk2, condHit2, condMiss2, depth)
-
-		case switchCases != "":
-			return this.selectByCases(section, switchCases, switchKey, false)
-
-		case multiswitchCases != "":
-			return this.selectByCases(section, multiswitchCases, multiswitchKey, true)
-
-		case mapK != "":
-			this.maps.insert(mapK, mapV, false)
-			rep = ""
-
-		case ignore != "" || gponly != "":
-			rep = "\n\n"
-		default:
-			rep = ""
-		}
-		return
-	})
-	return
 }
@@ -28,9 +28,7 @@
 package gogp
 
 import (
-	"bufio"
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 )
@@ -38,11 +36,35 @@ import (
 // gen .go file from .gp and .gpg
 func (this *gopgProcessor) procStep3Produce() (err error) {
 	//normal process
-	gpPath := this.getGpFullPath("")
+	gpPath := ""
+	if gpPath, err = this.getGpFullPath(""); err != nil {
+		return
+	}
 	gpgDir := filepath.Dir(this.gpgPath)
 
 	gpName := strings.TrimSuffix(filepath.Base(gpPath), gpExt)
 	codePath := this.getProductFilePath(gpgDir, gpName, this.getCodeFileSuffix(this.section))
+	defer func() {
+		if err != nil {
+			err = this.newError(gpPath, codePath, err)
+		}
+	}()
+
+	key, from := "", len(this.report.Entries)
+	if this.runner.cache != nil && !this.runner.writeAll() {
+		if key = this.cacheKey(gpPath); this.skipByCache(gpPath, codePath, key) { //product is not changed, skip rendering
+			return
+		}
+		this.onceSeen = make(map[string]bool)
+		defer func() {
+			if err == nil {
+				this.saveCache(codePath, key, from)
+			} else {
+				this.runner.cache.set(codePath, nil)
+			}
+			this.onceSeen = nil
+		}()
+	}
 
 	this.loadCodeFile(codePath) //load code file, ignore error
 	if this.gpPath != gpPath {  //load gp file if needed
@@ -63,11 +85,15 @@ func (this *gopgProcessor) procStep3Produce() (err error) {
 	return
 }
 
-func (this *gopgProcessor) doPredefReplace(gpPath, content, section string, nDepth int) (rep string) {
-	pathIdentify := fmt.Sprintf("%s|%s", relateGoPath(gpPath), relateGoPath(filepath.Dir(this.gpgPath))) //gp file+gpg path=unique
+//it returns the first error of #GOGP_REQUIRE(...), content should not be used then
+func (this *gopgProcessor) doPredefReplace(gpPath, content, section string, nDepth int) (rep string, err error) {
+	pathIdentify := fmt.Sprintf("%s|%s", relateGoPath(this.runner.fsys, gpPath), relateGoPath(this.runner.fsys, filepath.Dir(this.gpgPath))) //gp file+gpg path=unique
 	this.replaces.clear()
+	if _, ok := this.onceSeen[pathIdentify]; !ok && this.onceSeen != nil { //record how #GOGP_ONCE is processed for build cache
+		this.onceSeen[pathIdentify] = !this.runner.checkOnce(pathIdentify, false)
+	}
 
-	for _content, needReplace, i := content, true, 0; needReplace && i < 3; _content, i = rep, i+1 {
+	for _content, needReplace, i := content, true, 0; needReplace && i < 3 && err == nil; _content, i = rep, i+1 {
 		needReplace = false
 		rep = gogpExpPretreatAll.ReplaceAllStringFunc(_content, func(src string) (_rep string) {
 			//[]string{"", "IGNORE", "REQ", "REQP", "REQN", "REQGPG", "REQCONTENT", "GPGCFG", "ONCE", "REPSRC", "REPDST", "COMMENT"}
@@ -79,9 +105,9 @@ func (this *gopgProcessor) doPredefReplace(gpPath, content, section string, nDep
 				reqn = this.getGpgCfg(section, reqgpg, true)
 			}
 
-			if !optSilence && i > 1 {
-				fmt.Printf("##src=[%#v]\n i=%d ignore=[%s] req=[%s] reqp=[%s] reqn=[%s] reqgpg=[%s] gpgcfg=[%s] once=[%s] repsrc=[%s] repdst=[%s]\n",
-					src, i, ignore, req, reqp, reqn, reqgpg, gpgcfg, once, repsrc, repdst)
+			if i > 1 {
+				this.log(LevelDebug, "predef statement", Field{"src", src}, Field{"i", i}, Field{"ignore", ignore}, Field{"req", req}, Field{"reqp", reqp}, Field{"reqn", reqn},
+					Field{"reqgpg", reqgpg}, Field{"gpgcfg", gpgcfg}, Field{"once", once}, Field{"repsrc", repsrc}, Field{"repdst", repdst})
 			}
 
 			needReplace = true
@@ -95,12 +121,12 @@ func (this *gopgProcessor) doPredefReplace(gpPath, content, section string, nDep
 			case reqp != "":
 				if reqcontent == "" {
 					//require process
-					if r, _, err := this.procRequireReplacement(src, section, nDepth+1); err == nil {
-						_rep = r
-					} else {
-						fmt.Println(err)
+					r, _, e := this.procRequireReplacement(src, section, nDepth+1)
+					if e != nil && err == nil {
+						err = this.newError(gpPath, "", e)
 					}
-					req, reqn, reqcontent = req, reqn, reqcontent //never use
+					_rep = r
+					_, _, _ = req, reqn, reqcontent //never use
 				} else {
 					_rep = reqcontent
 				}
@@ -108,111 +134,109 @@ func (this *gopgProcessor) doPredefReplace(gpPath, content, section string, nDep
 			case gpgcfg != "":
 				_rep = this.getGpgCfg(section, gpgcfg, true)
 			case once != "":
-				if _, ok := onceMap[pathIdentify]; ok { //check if has processed this file
+				if this.runner.checkOnce(pathIdentify, false) { //check if has processed this file
 					_rep = "\n\n"
-					if debug {
-						fmt.Printf("[gogp debug]: %s GOGP_ONCE(%s:%s) ignore [%#v]\n", this.step, pathIdentify, section, once)
-					}
+					this.log(LevelDebug, "#GOGP_ONCE ignored", Field{"section", section}, Field{"once", pathIdentify}, Field{"src", once})
 
 				} else {
 					_rep = fmt.Sprintf("\n\n%s\n\n", once)
-					if debug {
-						fmt.Printf("[gogp debug]: %s GOGP_ONCE(%s:%s) ok [%#v]\n", this.step, pathIdentify, section, once)
-					}
+					this.log(LevelDebug, "#GOGP_ONCE ok", Field{"section", section}, Field{"once", pathIdentify}, Field{"src", once})
 				}
 			case repsrc != "":
 				_rep = ""
 				this.replaces.insert(repdst, repsrc, true)
-				if debug {
-					fmt.Printf("[debug]%s %s %s replace [%s] -> [%s]\n", gpPath, section, src, repsrc, repdst)
-				}
+				this.log(LevelDebug, "#GOGP_REPLACE", Field{"section", section}, Field{"gp", relateGoPath(this.runner.fsys, gpPath)}, Field{"src", src}, Field{"from", repsrc}, Field{"to", repdst})
 
 			default:
-				fmt.Printf("[gogp error]: %s invalid predef statement [%#v]\n", this.step, src)
+				this.log(LevelError, "invalid predef statement", Field{"section", section}, Field{"src", src})
 			}
 
 			return
 		})
 	}
 
-	if this.step == gogpStepPRODUCE { //prevent gen #GOGP_ONCE code twice when gen code
-		onceMap[pathIdentify] = true //record processed gp file
+	if err != nil {
+		return
+	}
+
+	if this.step == StepProduce { //prevent gen #GOGP_ONCE code twice when gen code
+		this.runner.checkOnce(pathIdentify, true) //record processed gp file
 	}
 
 	return
 }
 
 func (this *gopgProcessor) doGpReplace(gpPath, content, section string, nDepth int, second bool) (replacedGp string, err error) {
-	_path := fmt.Sprintf("%s|%s", relateGoPath(gpPath), relateGoPath(filepath.Dir(this.gpgPath))) //gp file+gpg path=unique
+	_path := fmt.Sprintf("%s|%s", relateGoPath(this.runner.fsys, gpPath), relateGoPath(this.runner.fsys, filepath.Dir(this.gpgPath))) //gp file+gpg path=unique
 
 	replacedGp = content
 	this.replaces.clear()
 
-	if this.step == gogpStepPRODUCE {
-		replacedGp = this.step3PretreatGpCodeSelector(replacedGp, section)
+	if this.step == StepProduce {
+		if replacedGp, err = this.step3PretreatGpCodeSelector(gpPath, replacedGp, section, !second); err != nil {
+			err = &ProcessError{Section: section, Gp: gpPath, Err: err}
+			return
+		}
 	}
 
-	replacedGp = this.doPredefReplace(gpPath, replacedGp, section, nDepth)
+	if replacedGp, err = this.doPredefReplace(gpPath, replacedGp, section, nDepth); err != nil {
+		return
+	}
 
 	//replaces keys that need be replacing
 	if this.replaces.Len() > 0 {
-		replacedGp, _ = this.replaces.doReplacing(replacedGp, this.gpgPath, true)
+		replacedGp, _, _ = this.replaces.doReplacing(this.log, replacedGp, "", true)
 		this.replaces.clear()
 	}
 
 	//gen code file content
 	this.buildMatches(section, gpPath, false, second)
 	replist := this.getReplist(second)
-	norep := 0
-	replacedGp, norep = replist.doReplacing(replacedGp, this.gpgPath, false)
+	norep, missing := 0, []string(nil)
+	replacedGp, norep, missing = replist.doReplacing(this.log, replacedGp, content, false)
 	this.nNoReplaceMathNum += norep
 
 	replacedGp = gogpExpEmptyLine.ReplaceAllString(replacedGp, "\n") //avoid multi empty lines
 
-	//remove more empty line
-	replacedGp = goFmt(replacedGp, this.gpgPath)
+	if this.nNoReplaceMathNum > 0 { //report error with positions of keys
+		msg := fmt.Sprintf("[%s depth=%d]", relateGoPath(this.runner.fsys, _path), nDepth)
+		if len(missing) > 0 {
+			msg += " at " + strings.Join(missing, ", ")
+		}
+		err = &ProcessError{
+			Section: replist.sectionName,
+			Gp:      gpPath,
+			Err:     fmt.Errorf("%w %s", ErrNoReplacing, msg),
+		}
+		return
+	}
 
-	if this.nNoReplaceMathNum > 0 { //report error
-		s := fmt.Sprintf("[gogp error]: [%s:%s %s depth=%d] not every gp have been replaced\n", relateGoPath(this.gpgPath), relateGoPath(_path), replist.sectionName, nDepth)
-		fmt.Printf("----**result is:\n%s\n----**end\n", replacedGp)
-		err = fmt.Errorf(s)
+	//remove more empty line
+	if replacedGp, err = goFmt(replacedGp); err != nil {
+		err = &ProcessError{Section: section, Gp: gpPath, Err: err}
 	}
 
 	return
 }
 
 func (this *gopgProcessor) saveCodeFile(body string) (err error) {
-	if optRemoveProductsOnly { //remove products only
-		this.nCodeFile++
-		this.remove(this.codePath)
+	if this.runner.RemoveProductsOnly { //remove products only
+		this.remove(this.gpPath, this.codePath)
 		return
 	}
-	if optForceUpdate || !strings.HasSuffix(this.codeContent, body) { //body change then save it,else skip it
-
-		var fout *os.File
-		if fout, err = os.OpenFile(this.codePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm); err != nil {
+	code := sealProduct(this.fileHead(this.gpPath, this.codePath, this.section) + "\n" + body)
+	if this.runner.writeAll() || this.codeContent != code { //inputs or body change then save it,else skip it
+		if err = this.checkModified(this.codeContent); err != nil {
+			err = this.newError(this.gpPath, this.codePath, err)
 			return
 		}
-		defer fout.Close()
-		wt := bufio.NewWriter(fout)
-
-		wt.WriteString(this.fileHead(this.gpPath, this.gpgPath, this.section))
-		wt.WriteByte('\n')
-		wt.WriteString(body)
-
-		if err = wt.Flush(); err != nil {
+		if err = this.rawSaveFile(this.codePath, code); err != nil {
 			return
 		}
 
-		this.nCodeFile++
-		if !optSilence {
-			fmt.Printf(">>[gogp][%s] ok\n", relateGoPath(this.codePath))
-		}
+		this.record(StatusWritten, this.gpPath, this.codePath)
 	} else {
-		this.nSkipCodeFile++
-		if !optSilence {
-			fmt.Printf(">>[gogp][%s] skip\n", relateGoPath(this.codePath))
-		}
+		this.record(StatusSkipped, this.gpPath, this.codePath)
 	}
 	return
 }
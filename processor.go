@@ -30,17 +30,13 @@ package gogp
 import (
 	"bytes"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"gogp/ini"
 )
 
-const maxRecursionDepth = 3
-
 //object to process gpg file
 type gopgProcessor struct {
 	gpgPath  string      //gpg file path
@@ -48,37 +44,101 @@ type gopgProcessor struct {
 	codePath string      //code file path
 	matches  replaceList //cases that need replacing
 
-	nNoReplaceMathNum int //number of math that has no replace string
-	nCodeFile         int
-	nSkipCodeFile     int
+	nNoReplaceMathNum int          //number of math that has no replace string
+	runner            *Runner      //runner that owns this processor
+	report            *Report      //results of this processor
+	logger            Logger       //where to log records, records of a group are kept in parallel mode
 	gpgContent        *ini.IniFile //gpg file content
 	gpContent         string
 	codeContent       string
-	section           string          //current gpg section name
-	step              gogpProcessStep //current processing step
-	matches2          replaceList     //cases that need replacing, secondary
-	replaces          replaceList     //keys that need replace
-	maps              replaceList     //keys that need replace
+	section           string      //current gpg section name
+	step              Step        //current processing step
+	matches2          replaceList //cases that need replacing, secondary
+	replaces          replaceList //keys that need replace
+	maps              replaceList //keys that need replace
+	dropIgnore        bool        //drop #GOGP_IGNORE blocks of main gp file when selecting code
+
+	onceSeen map[string]bool //gp files processed when producing current section with build cache, and if it is the first time
 }
 
-func (this *gopgProcessor) procGpg(file string, step gogpProcessStep) (err error) {
+func (this *gopgProcessor) procGpg(file string, step Step) (err error) {
 	this.gpContent = "" //clear gp content
 	this.step = step
-	if err = this.loadGpgFile(file); err == nil && this.hasTask(step) {
+	if this.report == nil {
+		this.report = &Report{fsys: this.runner.fsys}
+	}
+	if err = this.loadGpgFile(file); err != nil {
+		err = this.fail("", "", err)
+		return
+	}
+	if this.hasTask(step) {
 		for i, imp := range this.gpgContent.Sections() {
-			if err = this.genProduct(i, imp); err != nil {
-				fmt.Println(err)
-				//return
-			}
+			this.genProduct(i, imp) //error has been recorded to report
 		}
+		this.section = ""
+		this.record(StatusDone, "", "")
 	}
 	return
 }
 
+//record result of a gpg file, section or product
+func (this *gopgProcessor) record(status ReportStatus, gp, target string) {
+	this.report.add(&ReportEntry{
+		Step:    this.step,
+		Gpg:     this.gpgPath,
+		Section: this.section,
+		Gp:      gp,
+		Target:  target,
+		Status:  status,
+	})
+}
+
+//make a *ProcessError from err, fields that has been set will not be overwritten
+func (this *gopgProcessor) newError(gp, target string, err error) *ProcessError {
+	pe, ok := err.(*ProcessError)
+	if !ok {
+		pe = &ProcessError{Err: err}
+	}
+	if pe.Step == 0 {
+		pe.Step = this.step
+	}
+	if pe.Gpg == "" {
+		pe.Gpg = this.gpgPath
+	}
+	if pe.Section == "" {
+		pe.Section = this.section
+	}
+	if pe.Gp == "" {
+		pe.Gp = gp
+	}
+	if pe.Target == "" {
+		pe.Target = target
+	}
+	if pe.fsys == nil {
+		pe.fsys = this.runner.fsys
+	}
+	return pe
+}
+
+//record a failure of gpg, section or product
+func (this *gopgProcessor) fail(gp, target string, err error) error {
+	pe := this.newError(gp, target, err)
+	this.report.add(&ReportEntry{
+		Step:    pe.Step,
+		Gpg:     pe.Gpg,
+		Section: pe.Section,
+		Gp:      pe.Gp,
+		Target:  pe.Target,
+		Status:  StatusFailed,
+		Err:     pe,
+	})
+	return pe
+}
+
 //gen code or gp file
 func (this *gopgProcessor) genProduct(id int, impName string) (err error) {
-	if 0 == id && !optSilence {
-		fmt.Printf(">[gogp] %s: [%s]\n", this.step, relateGoPath(this.gpgPath))
+	if 0 == id {
+		this.log(LevelInfo, "processing gpg file")
 	}
 
 	if !this.isValidSection(impName, this.step) { //not a valid section for this step, do nothing
@@ -86,21 +146,22 @@ func (this *gopgProcessor) genProduct(id int, impName string) (err error) {
 	}
 
 	this.section = impName
+	this.gpPath, this.codePath = "", "" //files of last section, they are set by steps
 
-	if !optSilence {
-		fmt.Printf(">[gogp] %s [%s:%s] \n", this.step, relateGoPath(this.gpgPath), this.section)
-	}
+	this.log(LevelInfo, "processing section")
 
 	switch this.step {
-	case gogpStepREQUIRE:
+	case StepRequire:
 		err = this.procStep1Require()
-	case gogpStepREVERSE:
+	case StepReverse:
 		err = this.procStep2Reverse()
-	case gogpStepPRODUCE:
+	case StepProduce:
 		err = this.procStep3Produce()
 	}
 	if err != nil {
-		fmt.Printf("[gogp error]: %s [%s:%s] [%s]\n", this.step, relateGoPath(this.gpgPath), this.section, err.Error())
+		err = this.fail(this.gpPath, "", err)
+	} else {
+		this.record(StatusDone, this.gpPath, "")
 	}
 
 	return
@@ -144,13 +205,9 @@ func (this *gopgProcessor) getCodeFileSuffix(section string) (r string) {
 	return
 }
 
-func (this *gopgProcessor) reportNoReplacing(key, gpfile string) {
-	fmt.Printf("[gogp error]: %s [%s] has no replacing. [%s:%s %s]\n", this.step, key, relateGoPath(this.gpgPath), this.section, gpfile)
-}
-
 //if has set key GOGP_Name, use it, else use section name
-func (this *gopgProcessor) getGpName() (r string) {
-	if name := this.getGpgCfg(this.section, rawKeySrcPathName, true); name != "" {
+func (this *gopgProcessor) getGpName() (r string, err error) {
+	if name := this.getGpgCfg(this.section, rawKeySrcPathName, false); name != "" {
 		n := filepath.Base(name)
 		idx := 0
 		if idx = strings.Index(n, "."); idx < 0 { //split by first '.'
@@ -158,8 +215,7 @@ func (this *gopgProcessor) getGpName() (r string) {
 		}
 		r = n[:idx]
 	} else {
-		r = "missing"
-		fmt.Printf("[gogp error]: missing %s in %s:%s\n", rawKeySrcPathName, relateGoPath(this.gpgPath), this.section)
+		err = fmt.Errorf("%w [%s]", ErrMissingKey, rawKeySrcPathName)
 	}
 	return
 }
@@ -172,7 +228,10 @@ func (this *gopgProcessor) checkGpgCfg(section, key string) (ok bool) {
 }
 
 //check if a section is a valid task of step
-func (this *gopgProcessor) isValidSection(section string, step gogpProcessStep) (ok bool) {
+func (this *gopgProcessor) isValidSection(section string, step Step) (ok bool) {
+	if this.runner.sections != nil && !this.runner.sections[sectionKey(this.gpgPath, section)] { //not a target section
+		return
+	}
 	if !strings.HasPrefix(section, txtSectionIgnore) { //not an ignore section
 		if checkReverse := strings.HasPrefix(section, txtSectionReverse); checkReverse == step.IsReverse() { //if a proper section
 			if !this.checkGpgCfg(section, rawKeyIgnore) { //if has ignore key
@@ -183,7 +242,7 @@ func (this *gopgProcessor) isValidSection(section string, step gogpProcessStep)
 	return
 }
 
-func (this *gopgProcessor) hasTask(step gogpProcessStep) bool {
+func (this *gopgProcessor) hasTask(step Step) bool {
 	for _, imp := range this.gpgContent.Sections() {
 		if this.isValidSection(imp, step) {
 			return true
@@ -196,7 +255,10 @@ func (this *gopgProcessor) loadGpgFile(file string) (err error) {
 	file = formatPath(file)
 	this.gpPath = ""
 	this.gpgPath = formatPath(file)
-	this.gpgContent, err = ini.New(this.gpgPath)
+	var b []byte
+	if b, err = this.runner.readFile(this.gpgPath); err == nil {
+		this.gpgContent, err = ini.Parse(relateGoPath(this.runner.fsys, this.gpgPath), bytes.NewReader(b))
+	}
 	return
 }
 
@@ -220,6 +282,7 @@ func (this *gopgProcessor) buildMatches(section, gpPath string, reverse, second
 	pmatch.sectionName = section
 	pmatch.gpgPath = this.gpgPath
 	pmatch.gpPath = gpPath
+	pmatch.fsys = this.runner.fsys
 	if replaceList := this.gpgContent.Keys(section); replaceList != nil {
 		//make replace map
 		for _, key := range replaceList {
@@ -234,7 +297,7 @@ func (this *gopgProcessor) buildMatches(section, gpPath string, reverse, second
 
 func (this *gopgProcessor) rawLoadFile(file string) (content string, err error) {
 	var b []byte
-	if b, err = ioutil.ReadFile(file); err == nil {
+	if b, err = this.runner.readFile(file); err == nil {
 		//deal with new line
 		b = bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)
 
@@ -243,14 +306,9 @@ func (this *gopgProcessor) rawLoadFile(file string) (content string, err error)
 	return
 }
 func (this *gopgProcessor) rawSaveFile(file, content string) (err error) {
-	var fout *os.File
-	if fout, err = os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm); err != nil {
-		return
+	if err = this.runner.writeFile(file, []byte(content)); err != nil {
+		err = saveFileError(err)
 	}
-	defer fout.Close()
-
-	fout.WriteString(content)
-	fout.Sync()
 	return
 }
 
@@ -262,28 +320,39 @@ func (this *gopgProcessor) getGpgCfg(section, key string, warnEmpty bool) (val s
 			return
 		}
 		if warnEmpty {
-			fmt.Printf("[gogp warn]: [%s:%s] maybe lost key [%s]\n", relateGoPath(this.gpgPath), section, key)
+			this.log(LevelWarn, "maybe lost key", Field{"section", section}, Field{"key", key})
 		}
 	}
 	return
 }
 
-func (this *gopgProcessor) remove(file string) {
-	fmt.Printf(">>[gogp]: [%s] removed.\n", relateGoPath(file))
-	os.Remove(file)
+func (this *gopgProcessor) remove(gp, file string) {
+	if old, e := this.rawLoadFile(file); e == nil {
+		if err := this.checkModified(old); err != nil {
+			this.fail(gp, file, err)
+			return
+		}
+	}
+	switch err := this.runner.removeFile(file); {
+	case err == nil:
+		this.record(StatusRemoved, gp, file)
+	case os.IsNotExist(err):
+		this.record(StatusSkipped, gp, file)
+	default:
+		this.fail(gp, file, saveFileError(err))
+	}
 }
 
 func (this *gopgProcessor) getFakeSrcFilePath(pathWithName string) string {
-	return fmt.Sprintf("%s.%s%s", pathWithName, gpCodeFileSuffix, codeExt)
+	return fmt.Sprintf("%s.%s%s", pathWithName, gpCodeFileSuffix, this.runner.codeExt())
 }
 
 func (this *gopgProcessor) getProductFilePath(gpgDir, gpName, codeFileSuffix string) string {
-	return fmt.Sprintf("%s/%s.%s_%s%s", gpgDir, gpName, gpCodeFileSuffix, codeFileSuffix, codeExt)
+	return fmt.Sprintf("%s/%s.%s_%s%s", gpgDir, gpName, gpCodeFileSuffix, codeFileSuffix, this.runner.codeExt())
 
 }
 
-func (this *gopgProcessor) getGpFullPath(gp string) string {
-	gpPath := ""
+func (this *gopgProcessor) getGpFullPath(gp string) (gpPath string, err error) {
 	gpgDir := filepath.Dir(this.gpgPath)
 	if "" == gp {
 		gp = this.getGpgCfg(this.section, rawKeySrcPathName, false) //read gp file from another path or name
@@ -295,20 +364,20 @@ func (this *gopgProcessor) getGpFullPath(gp string) string {
 		if p, _ := filepath.Split(gp); p == "" || '.' == gp[0] { //if only config gp name, or lead with ".", use gpg dir
 			gpPath = filepath.Join(gpgDir, gp)
 		} else {
-			gpPath = filepath.Join(goPath, gp)
+			gpPath = resolveImportPath(this.runner.fsys, gpgDir, gp) //import-path-like, find it in modules or GoPath
 		}
 	} else {
-		fmt.Printf("[gogp error]: missing [%s] in [%s:%s]\n", rawKeySrcPathName, relateGoPath(this.gpgPath), this.section)
+		err = fmt.Errorf("%w [%s]", ErrMissingKey, rawKeySrcPathName)
 	}
-	return gpPath
+	return
 }
 
 func (this *gopgProcessor) loadGpFile(file string) (err error) {
 	this.gpContent = ""
 	this.gpPath = file
 	if this.gpContent, err = this.rawLoadFile(file); err == nil {
-		//ignore text format like "//#GOGP_IGNORE_BEGIN ... //#GOGP_IGNORE_END"
-		this.gpContent = gogpExpIgnore.ReplaceAllString(this.gpContent, "")
+		//text format like "//#GOGP_IGNORE_BEGIN ... //#GOGP_IGNORE_END" is dropped when selecting code,
+		//so that positions of directives and keys are the same as gp file
 	}
 	return
 }
@@ -329,29 +398,94 @@ func (this *gopgProcessor) getSrcFile(gp bool) string {
 	return this.codePath
 }
 
-func (this *gopgProcessor) fileHead(srcFile, gpgFile, section string) (h string) {
+//head of product file, it is the same if inputs of product are not changed
+//paths of inputs are related to dir of target, so the head does not depend on where the repo is
+func (this *gopgProcessor) fileHead(srcFile, target, section string) (h string) {
 	tool := filepath.ToSlash(filepath.Dir(thisFilePath))
-	h = fmt.Sprintf(`///////////////////////////////////////////////////////////////////
+	h = fmt.Sprintf(`%s
+
+%s
 //
 // !!!!!!!!!!!! NEVER MODIFY THIS FILE MANUALLY !!!!!!!!!!!!
 //
 // This file was auto-generated by tool [%s]
-// Last update at: [%s]
 // Generate from:
 //   [%s]
 //   [%s] [%s]
-//
+%s
+// Fingerprint: [%s]
+%s//
 // Tool [%s] info:
 %s
-///////////////////////////////////////////////////////////////////
+%s
 `,
+		txtGeneratedMark,
+		txtHeadBar,
 		tool,
-		time.Now().Format("Mon Jan 02 2006 15:04 MST"),
-		relateGoPath(srcFile),
-		relateGoPath(gpgFile),
+		relatePath(filepath.Dir(target), srcFile),
+		relatePath(filepath.Dir(target), this.gpgPath),
 		section,
+		provenanceLine(target, srcFile, this.gpgPath, section),
+		this.fingerprint(srcFile, section),
+		fmt.Sprintf(txtChecksumFmt, ""), //filled by sealProduct
 		tool,
 		copyRightCode,
+		txtHeadBar,
 	)
 	return
 }
+
+//fill checksum of body into head of product, body is text after head
+func sealProduct(code string) string {
+	if head, body, ok := splitProduct(code); ok {
+		return strings.Replace(head, fmt.Sprintf(txtChecksumFmt, ""), fmt.Sprintf(txtChecksumFmt, contentHash(body)), 1) + body
+	}
+	return code
+}
+
+//split product into head and body, ok is false if it has no checksum
+func splitProduct(code string) (head, body string, ok bool) {
+	i := strings.Index(code, txtChecksumPrefix)
+	if i < 0 {
+		return
+	}
+	end := "\n" + txtHeadBar + "\n"
+	j := strings.Index(code[i:], end)
+	if j < 0 {
+		return
+	}
+	n := i + j + len(end)
+	return code[:n], code[n:], true
+}
+
+//check if body of product does not match its checksum, products without checksum are never treated as modified
+func isModified(code string) bool {
+	head, body, ok := splitProduct(code)
+	if !ok {
+		return false
+	}
+	return !strings.Contains(head, fmt.Sprintf(txtChecksumFmt, contentHash(body)))
+}
+
+//refuse to overwrite or remove product that is modified by hand, unless ForceUpdate
+func (this *gopgProcessor) checkModified(oldCode string) error {
+	if !this.runner.ForceUpdate && isModified(oldCode) {
+		return fmt.Errorf("%w, move the change to gp file or gpg section, or run with -force to overwrite it", ErrModified)
+	}
+	return nil
+}
+
+//fingerprint of inputs of a product: content of source file, gpg section and version of gogp
+func (this *gopgProcessor) fingerprint(srcFile, section string) string {
+	src, _ := this.rawLoadFile(srcFile)
+	return fmt.Sprintf("gp=%s gpg=%s version=%s", contentHash(src), this.sectionHash(section), libVersion)
+}
+
+//hash of keys and values of a gpg section in declaration order
+func (this *gopgProcessor) sectionHash(section string) string {
+	var b strings.Builder
+	for _, key := range this.gpgContent.Keys(section) {
+		fmt.Fprintf(&b, "%s=%s\n", key, this.gpgContent.GetString(section, key, ""))
+	}
+	return contentHash(b.String())
+}
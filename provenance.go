@@ -0,0 +1,184 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gogp
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gogp/ini"
+)
+
+var provenanceExp = regexp.MustCompile(`(\w+)=("(?:[^"\\]|\\.)*")`) //key="quoted value" of provenance line
+
+// ProvenanceInfo tells where a file generated by gogp comes from.
+type ProvenanceInfo struct {
+	File    string     //generated file
+	Source  string     //gp file of a product, or fake go file of a gp file
+	Gpg     string     //gpg file
+	Section string     //gpg section
+	Keys    []KeyValue //keys of gpg section, in order of gpg file
+}
+
+// KeyValue is a key of gpg section and its value.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// SourceLine is a line of source file of a generated file.
+type SourceLine struct {
+	Line int //line number, from 1
+	Text string
+}
+
+// get provenance line of head of target, paths are related to dir of target so it is the same on every machine
+func provenanceLine(target, src, gpg, section string) string {
+	dir := filepath.Dir(target)
+	return fmt.Sprintf("%ssrc=%s gpg=%s section=%s", txtProvenancePrefix,
+		strconv.Quote(relatePath(dir, src)), strconv.Quote(relatePath(dir, gpg)), strconv.Quote(section))
+}
+
+// get slash path of file related to dir, or the whole path if it is not related
+func relatePath(dir, file string) string {
+	if rel, err := filepath.Rel(dir, file); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(file)
+}
+
+// read content of a generated file with new lines of "\n"
+func (r *Runner) readGenerated(file string) (string, error) {
+	b, err := r.fileSystem().ReadFile(file)
+	return string(bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)), err
+}
+
+// Provenance reads head of a file generated by gogp, and tells its source file, gpg file and section,
+// and key values of the section.
+// It returns ErrNoProvenance if file is not generated by gogp, or by an old version of it.
+// If gpg file can not be read or the section does not exist, the info is returned with the error.
+func (r *Runner) Provenance(file string) (info *ProvenanceInfo, err error) {
+	content, err := r.readGenerated(file)
+	if err != nil {
+		return nil, err
+	}
+	head, _, ok := splitProduct(content)
+	if !ok || !isGenerated(content) {
+		return nil, fmt.Errorf("%w [%s]", ErrNoProvenance, file)
+	}
+	var line string
+	for _, l := range strings.Split(head, "\n") {
+		if strings.HasPrefix(l, txtProvenancePrefix) {
+			line = l
+			break
+		}
+	}
+	if line == "" {
+		return nil, fmt.Errorf("%w [%s]", ErrNoProvenance, file)
+	}
+
+	dir := filepath.Dir(file)
+	info = &ProvenanceInfo{File: file}
+	for _, m := range provenanceExp.FindAllStringSubmatch(line, -1) {
+		v, e := strconv.Unquote(m[2])
+		if e != nil {
+			return nil, fmt.Errorf("%w [%s]: %v", ErrNoProvenance, file, e)
+		}
+		switch m[1] {
+		case "src":
+			info.Source = filepath.ToSlash(filepath.Join(dir, v))
+		case "gpg":
+			info.Gpg = filepath.ToSlash(filepath.Join(dir, v))
+		case "section":
+			info.Section = v
+		}
+	}
+
+	b, err := r.fileSystem().ReadFile(info.Gpg)
+	if err != nil {
+		return info, fmt.Errorf("%w [%s]: %v", ErrLoadFile, info.Gpg, err)
+	}
+	gpg, err := ini.Parse(relateGoPath(r.fileSystem(), info.Gpg), bytes.NewReader(b))
+	if err != nil {
+		return info, err
+	}
+	keys := gpg.Keys(info.Section)
+	if keys == nil {
+		return info, fmt.Errorf("%w [%s:%s]", ErrMissingSection, info.Gpg, info.Section)
+	}
+	for _, k := range keys {
+		info.Keys = append(info.Keys, KeyValue{Key: k, Value: gpg.GetString(info.Section, k, "")})
+	}
+	return info, nil
+}
+
+// SourceLines finds lines of source file that match lines of the generated file.
+// Lines are compared with <KEY>s replaced by values of gpg section,
+// so it works for products of gp files and gp files of fake go files both.
+func (r *Runner) SourceLines(info *ProvenanceInfo) (lines []SourceLine, err error) {
+	content, err := r.readGenerated(info.File)
+	if err != nil {
+		return nil, err
+	}
+	src, err := r.readGenerated(info.Source)
+	if err != nil {
+		return nil, err
+	}
+	pairs := make([]string, 0, 2*len(info.Keys))
+	for _, kv := range info.Keys {
+		pairs = append(pairs, "<"+kv.Key+">", kv.Value)
+	}
+	replacer := strings.NewReplacer(pairs...)
+	normalize := func(line string) string {
+		return strings.Join(strings.Fields(replacer.Replace(line)), " ") //gofmt may align lines in another way
+	}
+
+	_, body, _ := splitProduct(content)
+	generated := make(map[string]bool)
+	for _, l := range strings.Split(body, "\n") {
+		if l = normalize(l); l != "" {
+			generated[l] = true
+		}
+	}
+	for i, l := range strings.Split(src, "\n") {
+		if generated[normalize(l)] {
+			lines = append(lines, SourceLine{Line: i + 1, Text: l})
+		}
+	}
+	return
+}
+
+// Provenance reads head of a file generated by gogp, and tells where it comes from.
+// See Runner.Provenance for details.
+func Provenance(file string) (*ProvenanceInfo, error) {
+	return NewRunner(defaultConfig).Provenance(file)
+}
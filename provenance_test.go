@@ -0,0 +1,69 @@
+package gogp
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProvenance(t *testing.T) {
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/demo/box.gp":  tstGpBox,
+		"/app/demo/box.gpg": tstGpgBox,
+		"/app/demo/box.go":  "package demo\n",
+	})
+	runner := NewRunner(Config{Silence: true, FS: fsys})
+	if r, err := runner.Work("/app"); err != nil || r.Err() != nil {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+	b, _ := fsys.ReadFile("/app/demo/box.gp_int.go")
+	if !strings.Contains(string(b), "\n"+`// Provenance: src="box.gp" gpg="box.gpg" section="box_int"`+"\n") {
+		t.Fatalf("missing provenance:\n%s", b)
+	}
+	if !strings.Contains(string(b), "// Generate from:\n//   [box.gp]\n//   [box.gpg] [box_int]\n") {
+		t.Fatalf("unexpected head:\n%s", b)
+	}
+
+	info, err := runner.Provenance("/app/demo/box.gp_int.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ProvenanceInfo{
+		File:    "/app/demo/box.gp_int.go",
+		Source:  "/app/demo/box.gp",
+		Gpg:     "/app/demo/box.gpg",
+		Section: "box_int",
+		Keys: []KeyValue{
+			{"GOGP_GpFilePath", "box"},
+			{"PACKAGE", "package demo"},
+			{"VALUE_TYPE", "int"},
+			{"GLOBAL_NAME_PREFIX", "Int"},
+		},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Fatalf("got %#v\nwant %#v", info, want)
+	}
+
+	lines, err := runner.SourceLines(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, l := range lines {
+		got = append(got, l.Line)
+	}
+	if !reflect.DeepEqual(got, []int{5, 7, 8, 9, 11, 12, 13}) || lines[4].Text != "func (b *<GLOBAL_NAME_PREFIX>Box) Get() <VALUE_TYPE> {" {
+		t.Fatalf("lines: %v", lines)
+	}
+
+	//section is removed, the info is still returned
+	fsys.WriteFile("/app/demo/box.gpg", []byte(strings.Split(tstGpgBox, "[box_int]")[0]))
+	if info, err = runner.Provenance("/app/demo/box.gp_int.go"); !errors.Is(err, ErrMissingSection) || info == nil || info.Section != "box_int" {
+		t.Fatalf("info=%v err=%v", info, err)
+	}
+
+	if _, err = runner.Provenance("/app/demo/box.go"); !errors.Is(err, ErrNoProvenance) {
+		t.Fatalf("err=%v", err)
+	}
+}
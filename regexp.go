@@ -48,6 +48,13 @@ const (
 	txtRequireResultFmt   = "//#GOGP_IGNORE_BEGIN ///require begin from(%s)\n%s\n//#GOGP_IGNORE_END ///require end from(%s)"
 	txtRequireAtResultFmt = "///require begin from(%s)\n%s\n///require end from(%s)"
 	txtGogpIgnoreFmt      = "//#GOGP_IGNORE_BEGIN%s%s//#GOGP_IGNORE_END%s"
+
+	txtGeneratedMark  = "// Code generated by gogp. DO NOT EDIT." //standard mark of generated files, see https://golang.org/s/generatedcode
+	txtHeadBar        = "///////////////////////////////////////////////////////////////////"
+	txtChecksumPrefix = "// Checksum: [body="
+	txtChecksumFmt    = txtChecksumPrefix + "%s]\n" //checksum of body of product, text after head
+
+	txtProvenancePrefix = "// Provenance: " //parseable source of generated file, paths are related to dir of it
 )
 
 var (
@@ -54,6 +54,7 @@ type replaceList struct {
 	sectionName string
 	gpgPath     string
 	gpPath      string
+	fsys        FileSystem //file system of the run, to relate paths in logs
 }
 
 func (this *replaceList) sort() {
@@ -124,17 +125,20 @@ func (this *replaceList) expString() (exp string) {
 	return exp
 }
 
-func (this *replaceList) doReplacing(content, _path string, reverse bool) (rep string, noRep int) {
+// replace keys of content, keys that have no replacing are reported with their positions in src,
+// which is the gp file that content comes from, and where they are first found is returned as missing
+func (this *replaceList) doReplacing(log logFunc, content, src string, reverse bool) (rep string, noRep int, missing []string) {
 	reg := gogpExpTodoReplace
 	if reverse {
 		exp := this.expString()
 		reg = regexp.MustCompile(exp)
 	}
 
-	rep = reg.ReplaceAllStringFunc(content, func(src string) (r string) {
-		w := src
+	var keys []string
+	rep = reg.ReplaceAllStringFunc(content, func(s string) (r string) {
+		w := s
 		if !reverse {
-			elem := reg.FindAllStringSubmatch(src, 1)[0]
+			elem := reg.FindAllStringSubmatch(s, 1)[0]
 			w = elem[1]
 		}
 		if v, ok := this.getMatch(w); ok {
@@ -145,13 +149,48 @@ func (this *replaceList) doReplacing(content, _path string, reverse bool) (rep s
 				r = wv
 			}
 		} else {
-			fmt.Printf("[gogp error]: [%s] has no replacing.[%s] [%s : %s]\n", w, relateGoPath(this.gpPath), relateGoPath(this.gpgPath), this.sectionName)
-
-			r = src
+			if !reverse && !hasString(keys, w) {
+				keys = append(keys, w)
+			}
+			r = s
 			noRep++
 		}
 		return
 	})
 
+	for _, key := range keys {
+		missing = append(missing, this.reportNoReplacing(log, key, src))
+	}
 	return
 }
+
+// log every position of key in src, which has no replacing,
+// and return the first one like "gp:line:col <key>", or only the key if it is not in src
+func (this *replaceList) reportNoReplacing(log logFunc, key, src string) (where string) {
+	gp := relateGoPath(this.fsys, this.gpPath)
+	fields := []Field{{"gpg", relateGoPath(this.fsys, this.gpgPath)}, {"section", this.sectionName}, {"gp", gp}}
+	for pos, i := 0, strings.Index(src, key); i >= 0; i = strings.Index(src[pos:], key) {
+		pos += i
+		line := strings.Count(src[:pos], "\n") + 1
+		col := pos - strings.LastIndexByte(src[:pos], '\n')
+		log(LevelError, "key has no replacing", append(fields, Field{"line", line}, Field{"col", col}, Field{"key", key})...)
+		if where == "" {
+			where = fmt.Sprintf("%s:%d:%d %s", gp, line, col, key)
+		}
+		pos += len(key)
+	}
+	if where == "" { //key comes from gpg file or #GOGP_REPLACE
+		log(LevelError, "key has no replacing", append(fields, Field{"key", key})...)
+		where = key
+	}
+	return
+}
+
+func hasString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,305 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gogp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissingKey     = errors.New("missing key")            //required gpg key is not defined
+	ErrNoReplacing    = errors.New("not every key replaced") //some <KEY> of gp file has no replacing
+	ErrMissingSection = errors.New("missing section")        //required gpg section is not defined
+	ErrRequireLoop    = errors.New("maybe loop recursive")   //#GOGP_REQUIRE(...) nested too deep
+	ErrGoFmt          = errors.New("gofmt failed")           //product is not valid go code
+	ErrLoadFile       = errors.New("load file failed")       //gp/gpg/code file can not be read
+	ErrSaveFile       = errors.New("save file failed")       //product can not be written or removed
+	ErrModified       = errors.New("modified by hand")       //body of product does not match its checksum
+	ErrNoProvenance   = errors.New("no provenance")          //file is not generated by gogp, or by an old version of it
+	ErrDirective      = errors.New("invalid directive")      //#GOGP_* directives of gp file are malformed or unbalanced
+)
+
+// ProcessError is the error type of gogp processing.
+// It wraps one of the Err* errors above, or an underlying I/O error.
+type ProcessError struct {
+	Step    Step
+	Gpg     string //gpg file path
+	Section string //gpg section name
+	Gp      string //gp file path
+	Target  string //product file path
+	Err     error
+
+	fsys FileSystem //file system of the run to relate paths, OS file system if it is nil
+}
+
+func (e *ProcessError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[gogp error]: %s [%s", e.Step, relateGoPath(e.fsys, e.Gpg))
+	if e.Section != "" {
+		fmt.Fprintf(&b, ":%s", e.Section)
+	}
+	b.WriteByte(']')
+	if e.Gp != "" {
+		fmt.Fprintf(&b, " [%s]", relateGoPath(e.fsys, e.Gp))
+	}
+	if e.Target != "" {
+		fmt.Fprintf(&b, " [%s]", relateGoPath(e.fsys, e.Target))
+	}
+	fmt.Fprintf(&b, " %s", e.Err.Error())
+	return b.String()
+}
+
+func (e *ProcessError) Unwrap() error {
+	return e.Err
+}
+
+// DirectiveError is a malformed or unbalanced #GOGP_* directive of gp file.
+// It wraps ErrDirective.
+type DirectiveError struct {
+	File      string //gp file path
+	Line      int    //position of the error, from 1
+	Col       int
+	Msg       string
+	Block     string //directive of the enclosing block, eg: "#GOGP_IFDEF", empty if it is out of any block
+	BlockLine int    //start position of the enclosing block
+	BlockCol  int
+}
+
+func (e *DirectiveError) Error() string {
+	s := fmt.Sprintf("%s:%d:%d: %s: %s", e.File, e.Line, e.Col, ErrDirective, e.Msg)
+	if e.Block != "" {
+		s += fmt.Sprintf(" (in %s at %s:%d:%d)", e.Block, e.File, e.BlockLine, e.BlockCol)
+	}
+	return s
+}
+
+func (e *DirectiveError) Unwrap() error {
+	return ErrDirective
+}
+
+// error of writing or removing a file, it is both ErrSaveFile and the underlying I/O error
+type saveError struct {
+	err error
+}
+
+func saveFileError(err error) error {
+	return &saveError{err: err}
+}
+
+func (e *saveError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrSaveFile, e.err)
+}
+
+func (e *saveError) Is(target error) bool {
+	return target == ErrSaveFile
+}
+
+func (e *saveError) Unwrap() error {
+	return e.err
+}
+
+// ReportStatus is the result of one report entry.
+type ReportStatus int
+
+const (
+	StatusWritten ReportStatus = iota + 1 //product has been written
+	StatusSkipped                         //product has no change
+	StatusRemoved                         //product has been removed
+	StatusFailed                          //gpg/section/product failed
+	StatusDone                            //gpg/section has been processed, results of its products are entries of their own
+)
+
+func (s ReportStatus) String() (r string) {
+	switch s {
+	case StatusWritten:
+		r = "written"
+	case StatusSkipped:
+		r = "skipped"
+	case StatusRemoved:
+		r = "removed"
+	case StatusFailed:
+		r = "failed"
+	case StatusDone:
+		r = "done"
+	default:
+		r = "unknown"
+	}
+	return
+}
+
+// ReportEntry records the result of one gpg file, section or product.
+// Target is empty if the entry is about a section, and Section is empty too if it is about the whole gpg file.
+type ReportEntry struct {
+	Step    Step
+	Gpg     string //gpg file path
+	Section string //gpg section name
+	Gp      string //gp file path
+	Target  string //product file path
+	Status  ReportStatus
+	Err     error //*ProcessError if Status is StatusFailed
+
+	fsys FileSystem //file system of the run to relate paths, OS file system if it is nil
+}
+
+func (e *ReportEntry) String() string {
+	switch {
+	case e.Status == StatusFailed:
+		return fmt.Sprintf("%-8s %s", e.Status, e.Err)
+	case e.Target == "": //entry of gpg file or section
+		s := fmt.Sprintf("%-8s [%s", e.Status, relateGoPath(e.fsys, e.Gpg))
+		if e.Section != "" {
+			s += ":" + e.Section
+		}
+		return s + "]"
+	}
+	return fmt.Sprintf("%-8s %s <- [%s] [%s:%s]", e.Status, relateGoPath(e.fsys, e.Target), relateGoPath(e.fsys, e.Gp), relateGoPath(e.fsys, e.Gpg), e.Section)
+}
+
+// Report is the result of a gogp work process.
+type Report struct {
+	Dir     string         //working dir
+	Gpgs    []string       //gpg files that has been processed
+	Entries []*ReportEntry //results of every gpg, section and product
+	Cost    time.Duration
+
+	InMemory   bool      //products are kept in memory rather than written to disk
+	Changes    []*Change //file changes in memory if InMemory is true
+	RolledBack bool      //outputs are discarded because of failures in transactional mode
+
+	fsys FileSystem //file system of the run to relate paths, OS file system if it is nil
+}
+
+//add an entry, paths of it and its error are related in file system of the report
+func (r *Report) add(e *ReportEntry) {
+	if e.fsys == nil {
+		e.fsys = r.fsys
+	}
+	if pe, ok := e.Err.(*ProcessError); ok && pe.fsys == nil {
+		pe.fsys = e.fsys
+	}
+	r.Entries = append(r.Entries, e)
+}
+
+func (r *Report) merge(other *Report) {
+	for _, e := range other.Entries {
+		r.add(e)
+	}
+}
+
+// Count returns number of entries with status s.
+func (r *Report) Count(s ReportStatus) (n int) {
+	for _, e := range r.Entries {
+		if e.Status == s {
+			n++
+		}
+	}
+	return
+}
+
+// Failed returns entries with StatusFailed.
+func (r *Report) Failed() (l []*ReportEntry) {
+	for _, e := range r.Entries {
+		if e.Status == StatusFailed {
+			l = append(l, e)
+		}
+	}
+	return
+}
+
+// Err returns the first error of failed entries, or nil if all is ok.
+func (r *Report) Err() error {
+	if l := r.Failed(); len(l) > 0 {
+		if len(l) == 1 {
+			return l[0].Err
+		}
+		return fmt.Errorf("%w (and %d more error(s))", l[0].Err, len(l)-1)
+	}
+	return nil
+}
+
+// Summary returns a one line summary of the report.
+func (r *Report) Summary() string {
+	nCode := r.Count(StatusWritten) + r.Count(StatusRemoved)
+	nSkip := r.Count(StatusSkipped)
+	s := fmt.Sprintf("[gogp][%s] %d/%d product(s) updated from %d gpg file(s) in %s.", relateGoPath(r.fsys, r.Dir), nCode, nCode+nSkip, len(r.Gpgs), r.Cost)
+	if n := r.Count(StatusFailed); n > 0 {
+		s += fmt.Sprintf(" %d error(s).", n)
+	}
+	if r.InMemory {
+		s += fmt.Sprintf(" %d file(s) out of date.", len(r.Changes))
+	}
+	if r.RolledBack {
+		s += " All changes are rolled back."
+	}
+	return s
+}
+
+// Render writes report to w.
+// Failed entries are always written, the others are written in verbose mode only.
+func (r *Report) Render(w io.Writer, verbose bool) {
+	for _, e := range r.Entries {
+		if verbose || e.Status == StatusFailed {
+			fmt.Fprintln(w, e)
+		}
+	}
+	for _, c := range r.Changes {
+		fmt.Fprintln(w, c)
+	}
+	fmt.Fprintln(w, r.Summary())
+}
+
+// Log logs report to l with structured fields, like Render.
+// Failed entries are logged as errors, the others are logged in verbose mode only.
+func (r *Report) Log(l Logger, verbose bool) {
+	for _, e := range r.Entries {
+		if verbose || e.Status == StatusFailed {
+			level := LevelInfo
+			fields := []Field{{"step", e.Step.Name()}, {"gpg", relateGoPath(e.fsys, e.Gpg)}, {"section", e.Section},
+				{"gp", relateGoPath(e.fsys, e.Gp)}, {"product", relateGoPath(e.fsys, e.Target)}}
+			if e.Status == StatusFailed {
+				level, fields = LevelError, append(fields, Field{"err", e.Err})
+			}
+			l.Log(level, e.Status.String(), fields...)
+		}
+	}
+	for _, c := range r.Changes {
+		l.Log(LevelInfo, c.Kind.String(), Field{"product", relateGoPath(r.fsys, c.Path)})
+	}
+	l.Log(LevelInfo, r.Summary(), Field{"written", r.Count(StatusWritten)}, Field{"removed", r.Count(StatusRemoved)}, Field{"failed", r.Count(StatusFailed)})
+}
+
+// RenderDiff writes unified diffs of changes in memory to w.
+func (r *Report) RenderDiff(w io.Writer) {
+	for _, c := range r.Changes {
+		io.WriteString(w, c.Diff())
+	}
+}
@@ -0,0 +1,318 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gogp
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config is options of gogp work process.
+type Config struct {
+	ForceUpdate        bool   //force update all products
+	Silence            bool   //work silencely
+	RemoveProductsOnly bool   //remove products only
+	CodeExt            string //extension of code file, ".go" is default
+	Debug              bool   //debug switch
+	Jobs               int    //number of gpg directories processed in parallel, <=1 means serial
+	CheckOnly          bool   //run in memory without writing anything, and report changes
+	DryRun             bool   //run in memory without writing anything, and report changes with diffs
+
+	FS       FileSystem //file system to work on, OS file system if nil
+	Steps    []Step     //steps to run in order, all steps if empty
+	Excludes []string   //patterns of paths to exclude in syntax of .gogpignore, they take precedence over .gogpignore files
+	NoCache  bool       //do not use build cache in .gogp/cache of module root or working dir
+	Logger   Logger     //where to log records of work process, text to stdout if nil
+
+	Transactional bool //stage all outputs in memory, and write them only if every gpg, section and product succeeds
+}
+
+// get extension of code file, ".go" is default, ".gp" and ".gpg" is not allowed
+func (cfg *Config) codeExt() string {
+	if n := cfg.CodeExt; n != "" && n != gpExt && n != gpgExt {
+		return n
+	}
+	return defaultCodeExt
+}
+
+// get file system to work on
+func (cfg *Config) fileSystem() FileSystem {
+	if cfg.FS != nil {
+		return cfg.FS
+	}
+	return OSFileSystem{}
+}
+
+// Runner runs gogp work process with its own Config.
+// State of a run such as records of #GOGP_ONCE is scoped to one call of Work,
+// so runners never interfere with each other.
+type Runner struct {
+	Config
+
+	lock          sync.Mutex      //protect onceMap and savedCodeFile in parallel mode
+	onceMap       map[string]bool //record once processed files
+	savedCodeFile map[string]bool //record saved code files
+	staged        *overlay        //file changes in memory, nil if write to disk directly
+	fsys          FileSystem      //file system of this run, staged if it is not nil
+	sections      map[string]bool //sections to process keyed by sectionKey, all sections if nil
+	cache         *buildCache     //build cache of this run, nil if it is disabled
+	manifest      *manifest       //manifest of root of this run
+	unlocks       []func() error  //release locks of roots of this run
+	renderAll     bool            //write products that are up to date too, but never overwrite the modified ones
+}
+
+// NewRunner create a Runner with config cfg.
+func NewRunner(cfg Config) *Runner {
+	return &Runner{Config: cfg}
+}
+
+// reset state of last run
+func (r *Runner) reset() {
+	r.onceMap = make(map[string]bool)
+	r.savedCodeFile = make(map[string]bool)
+	r.staged = nil
+	r.sections = nil
+	r.cache = nil
+	r.manifest = nil
+	r.fsys = r.fileSystem()
+	if r.inMemory() || r.Transactional {
+		r.staged = newOverlay(r.fsys)
+		r.fsys = r.staged
+	}
+}
+
+// check if products are written even if they are up to date
+func (r *Runner) writeAll() bool {
+	return r.ForceUpdate || r.renderAll
+}
+
+// check if products are kept in memory without writing anything
+func (r *Runner) inMemory() bool {
+	return r.CheckOnly || r.DryRun
+}
+
+func (r *Runner) readFile(file string) ([]byte, error) {
+	return r.fsys.ReadFile(file)
+}
+
+func (r *Runner) writeFile(file string, b []byte) error {
+	return r.fsys.WriteFile(file, b)
+}
+
+func (r *Runner) removeFile(file string) error {
+	return r.fsys.Remove(file)
+}
+
+// check if #GOGP_ONCE of gp file has been processed, and mark it processed if mark is true
+func (r *Runner) checkOnce(pathIdentify string, mark bool) (processed bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	processed = r.onceMap[pathIdentify]
+	if mark {
+		r.onceMap[pathIdentify] = true
+	}
+	return
+}
+
+// mark code file saved, return false if it has been saved before
+func (r *Runner) markSaved(codePath string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.savedCodeFile[codePath] {
+		return false
+	}
+	r.savedCodeFile[codePath] = true
+	return true
+}
+
+// Work gen code from gp files in dir, and report result of every gpg, section and product.
+// Failures of gpg files and sections are recorded in report instead of returned.
+// If dir is a gpg file, or a section of gpg file like "path/to/file.gpg:section",
+// it works as WorkFile or WorkSection.
+func (r *Runner) Work(dir string) (rpt *Report, err error) {
+	if gpg, section, ok := splitTarget(dir); ok {
+		return r.WorkSection(gpg, section)
+	}
+
+	start := time.Now()
+	r.reset()
+
+	dirs := r.workDirs(dir)
+	rpt = &Report{Dir: formatPath(dirs[0]), InMemory: r.inMemory(), fsys: r.fsys}
+
+	r.lockRoots(dirs...)
+	r.openCache(dirs[0])
+	r.openManifest(dirs[0])
+
+	var list []string
+	w := &walker{fsys: r.fsys, ext: gpgExt, patterns: r.Excludes, warn: r.walkWarning}
+	for _, dir := range dirs {
+		dir = formatPath(dir)
+		var l []string
+		if l, err = w.collect(dir); err != nil {
+			break
+		}
+		if len(l) > 0 {
+			r.log(LevelInfo, "working at", Field{"path", relateGoPath(r.fsys, dir)})
+		}
+		list = append(list, l...)
+	}
+	if err == nil {
+		r.process(list, rpt)
+	}
+	r.finish(start, rpt)
+
+	return
+}
+
+// get dirs to work on of dir, which may be "gopath", "workpath" or a Go-style package pattern
+func (r *Runner) workDirs(dir string) []string {
+	dirs := []string{dir}
+	if dir == "" || strings.ToLower(dir) == "gopath" { //if not set a dir,use GoPath, or main module in module mode
+		dirs = defaultWorkDirs(r.fsys)
+	} else if dir == "." || strings.ToLower(dir) == "workpath" {
+		dirs = []string{workPath()}
+	} else if d, ok := packagePatternDir(r.fsys, dir); ok { //Go-style package pattern like "./..."
+		dirs = []string{d}
+	}
+	return dirs
+}
+
+// run all steps on gpg files of list
+func (r *Runner) process(list []string, rpt *Report) {
+	rpt.Gpgs = list
+	groups := groupByDir(list)
+	steps := r.Steps
+	if len(steps) == 0 {
+		steps = getProcessingSteps(r.RemoveProductsOnly)
+	}
+	for _, step := range steps {
+		r.runStep(step, groups, rpt)
+	}
+}
+
+// fill changes in memory and time cost of a run
+func (r *Runner) finish(start time.Time, rpt *Report) {
+	if r.inMemory() {
+		rpt.Changes = r.staged.changes()
+	} else if r.staged != nil {
+		r.commit(rpt)
+	}
+	if !rpt.RolledBack {
+		r.closeCache()
+		r.closeManifest(rpt)
+	}
+	r.unlockRoots()
+	rpt.Cost = time.Now().Sub(start)
+}
+
+// commit staged outputs of transactional mode if every gpg, section and product succeeds,
+// otherwise roll back, and nothing is written
+func (r *Runner) commit(rpt *Report) {
+	if rpt.Count(StatusFailed) > 0 {
+		rpt.RolledBack = true
+		return
+	}
+	if path, err := r.staged.commit(); err != nil {
+		rpt.add(&ReportEntry{Target: path, Status: StatusFailed, Err: &ProcessError{Target: path, Err: saveFileError(err)}})
+		rpt.RolledBack = true
+	}
+}
+
+// group gpg files by directory, so different groups can be processed in parallel safely.
+// Every step writes files of a gpg file in its directory only, and #GOGP_ONCE records are keyed by gp file and gpg directory.
+// A gp file may be shared by gpg files of different directories, which only read it,
+// and runStep finishes a step on all groups before the next one, so gp files written by StepReverse are complete before they are read.
+func groupByDir(list []string) (groups [][]string) {
+	index := make(map[string]int)
+	for _, gpg := range list {
+		dir := filepath.Dir(gpg)
+		if i, ok := index[dir]; ok {
+			groups[i] = append(groups[i], gpg)
+		} else {
+			index[dir] = len(groups)
+			groups = append(groups, []string{gpg})
+		}
+	}
+	return
+}
+
+// run a step on every group of gpg files.
+// In parallel mode, messages and reports of groups are merged in order of groups,
+// so the output is the same as serial mode.
+func (r *Runner) runStep(step Step, groups [][]string, rpt *Report) {
+	type result struct {
+		log    bufferLogger
+		report Report
+	}
+
+	parallel := r.Jobs > 1 && len(groups) > 1
+	results := make([]result, len(groups))
+	work := func(i int) {
+		res := &results[i]
+		logger := r.logger()
+		if parallel {
+			logger = &res.log
+		}
+		for _, gpg := range groups[i] {
+			p := gopgProcessor{runner: r, report: &res.report, logger: logger}
+			p.procGpg(gpg, step) //error has been recorded to report
+		}
+	}
+
+	if parallel {
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for n := 0; n < r.Jobs && n < len(groups); n++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					work(i)
+				}
+			}()
+		}
+		for i := range groups {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+	} else {
+		for i := range groups {
+			work(i)
+		}
+	}
+
+	for i := range results {
+		res := &results[i]
+		res.log.flush(r.logger())
+		rpt.merge(&res.report)
+	}
+}
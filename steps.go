@@ -27,37 +27,58 @@
 
 package gogp
 
-type gogpProcessStep int
+// Step is a processing step of gogp work flow.
+type Step int
 
-func (me gogpProcessStep) IsReverse() bool {
-	return me >= gogpStepREQUIRE && me <= gogpStepREVERSE
+func (me Step) IsReverse() bool {
+	return me >= StepRequire && me <= StepReverse
 }
 
-func (me gogpProcessStep) String() (s string) {
+func (me Step) String() (s string) {
 	switch me {
-	case gogpStepREQUIRE:
+	case StepRequire:
 		s = "Step=[1RequireReplace]"
-	case gogpStepREVERSE:
+	case StepReverse:
 		s = "Step=[2ReverseWork]"
-	case gogpStepPRODUCE:
+	case StepProduce:
 		s = "Step=[3NormalProduce]"
+	case StepPrune:
+		s = "Step=[4Prune]"
 	default:
 		s = "Step=Unknown"
 	}
 	return
 }
 
+// Name is short name of step, like "produce".
+func (me Step) Name() (s string) {
+	switch me {
+	case StepRequire:
+		s = "require"
+	case StepReverse:
+		s = "reverse"
+	case StepProduce:
+		s = "produce"
+	case StepPrune:
+		s = "prune"
+	default:
+		s = "unknown"
+	}
+	return
+}
+
 const (
-	gogpStepREQUIRE gogpProcessStep = iota + 1 // require replace in fake go file
-	gogpStepREVERSE                            // gen gp file from fake go file
-	gogpStepPRODUCE                            // gen go file from gp file
+	StepRequire Step = iota + 1 // require replace in fake go file
+	StepReverse                 // gen gp file from fake go file
+	StepProduce                 // gen go file from gp file
+	StepPrune                   // remove generated files that are no longer produced, it is run by Prune only
 )
 
 // get steps of gogp processor
-func getProcessingSteps(removeProductsOnly bool) []gogpProcessStep {
-	steps := []gogpProcessStep{gogpStepREVERSE, gogpStepREQUIRE, gogpStepREVERSE, gogpStepPRODUCE} //reverse work first
+func getProcessingSteps(removeProductsOnly bool) []Step {
+	steps := []Step{StepReverse, StepRequire, StepReverse, StepProduce} //reverse work first
 	if removeProductsOnly {
-		steps = []gogpProcessStep{gogpStepPRODUCE, gogpStepREQUIRE, gogpStepREVERSE} //normal work first
+		steps = []Step{StepProduce, StepRequire, StepReverse} //normal work first
 	}
 	return steps
 }
@@ -48,11 +48,12 @@ var allSyntax = []*syntax{
 	//--------------------------------------------------------------------------
 	&syntax{
 		name:  "#if",
-		usage: "double-way branch selector by condition",
-		expr:  `(?sm:^(?:[ \t]*/{2,}[ \t]*)#GOGP_IFDEF[ \t]+(?P<IFCOND>[[:word:]<>\|!= \t]+)(?:.*?$[\r\n]?)(?P<IFT>.*?)(?:(?:[ \t]*/{2,}[ \t]*)#GOGP_ELSE(?:(?:[ \t].*?)?$[\r\n]?)(?P<IFF>.*?))?(?:[ \t]*/{2,}[ \t]*)#GOGP_ENDIF(?:[ \t].*?)?$[\r\n]?)`,
+		usage: "multi-way branch selector by condition, the first branch of #GOGP_IFDEF and #GOGP_ELIF that matches is selected. #if, #switch and #once can be nested in each other to any depth",
 		syntax: `
 // #GOGP_IFDEF <key> || ! <key> || <key> == xxx || <key> != xxx
 	{true content}
+[// #GOGP_ELIF <key> || ! <key> || <key> == xxx || <key> != xxx
+	{elif content}]
 [// #GOGP_ELSE
 	{else content}]
 // #GOGP_ENDIF
@@ -66,8 +67,7 @@ var allSyntax = []*syntax{
 	&syntax{
 		ignoreInList: false,
 		name:         "#if2",
-		usage:        "double-way branch selector by condition, to nested with #if",
-		expr:         `(?sm:^(?:[ \t]*/{2,}[ \t]*)#GOGP_IFDEF2[ \t]+(?P<IFCOND2>[[:word:]<>\|!= \t]+)(?:.*?$[\r\n]?)(?P<IFT2>.*?)(?:(?:[ \t]*/{2,}[ \t]*)#GOGP_ELSE2(?:(?:[ \t].*?)?$[\r\n]?)(?P<IFF2>.*?))?(?:[ \t]*/{2,}[ \t]*)#GOGP_ENDIF2(?:[ \t].*?)?$[\r\n]?)`,
+		usage:        "same as #if, which is kept for old gp files that nest it in #if",
 		syntax: `
 // #GOGP_IFDEF2 <key> || ! <key> || <key> == xxx || <key> != xxx
 	{true content}
@@ -84,7 +84,6 @@ var allSyntax = []*syntax{
 	&syntax{
 		name:  "#switch",
 		usage: "multi-way branch selector by condition. It is one-switch logic(only one case brantch can trigger out)",
-		expr:  `(?sm:(?:^[ \t]*/{2,}[ \t]*)(?:#GOGP_SWITCH)(?:[ \t]+(?P<SWITCHKEY>[[:word:]<>]+))?(?:.*?$)[\r\n]?(?P<SWITCHCONTENT>.*?)(?:^[ \t]*/{2,}[ \t]*)#GOGP_ENDSWITCH(?:[ \t].*?)?$[\r\n]?)`,
 		syntax: `
 // #GOGP_SWITCH [<SwitchKey>] 
 //    #GOGP_CASE <key> || !<key> || <key> == xxx || <key> != xxx || <SwitchKeyValue> || !<SwitchKeyValue>
@@ -100,7 +99,6 @@ var allSyntax = []*syntax{
 	&syntax{
 		name:  "#multi-switch",
 		usage: "multi-way branch selector by condition. It is multi-switch logic(more than one case brantch can trigger out)",
-		expr:  `(?sm:(?:^[ \t]*/{2,}[ \t]*)(?:#GOGP_MULTISWITCH)(?:[ \t]+(?P<MULTISWITCHKEY>[[:word:]<>]+))?(?:.*?$)[\r\n]?(?P<MULTISWITCHCONTENT>.*?)(?:^[ \t]*/{2,}[ \t]*)#GOGP_ENDMULTISWITCH(?:[ \t].*?)?$[\r\n]?)`,
 		syntax: `
 // #GOGP_MULTISWITCH [<MultiSwitchKey>] 
 //    #GOGP_CASE <key> || !<key> || <key> == xxx || <key> != xxx || <SwitchKeyValue> || !<SwitchKeyValue>
@@ -117,7 +115,6 @@ var allSyntax = []*syntax{
 		ignoreInList: false,
 		name:         "#case",
 		usage:        "branches of #switch/#multi-switch syntax",
-		expr:         `(?sm:(?:^[ \t]*/{2,}[ \t]*)(?:(?:#GOGP_CASE[ \t]+(?P<CASEKEY>[[:word:]<>\!]+))|(?:#GOGP_DEFAULT))(?:[ \t]*?.*?$)[\r\n]*(?P<CASECONTENT>.*?)(?:^[ \t]*/{2,}[ \t]*)#GOGP_ENDCASE.*?$[\r\n]*)`,
 		syntax: `
 //    #GOGP_CASE <key> || !<key> || <key> == xxx || <key> != xxx || <SwitchKeyValue> || !<SwitchKeyValue>
         {case content}
@@ -211,7 +208,7 @@ var allSyntax = []*syntax{
 	//--------------------------------------------------------------------------
 	&syntax{
 		name:  "#once",
-		usage: "code that will generate once during one .gp file processing.",
+		usage: "code that will generate once during one .gp file processing. A nested #once belongs to the outermost one.",
 		expr:  `(?sm:(?:^[ \t]*/{2,}[ \t]*)#GOGP_ONCE(?:[ \t]*?//.*?$)?[\r\n]*(?P<ONCE>.*?)[\r\n]?(?:^[ \t]*/{2,}[ \t]*)#GOGP_END_ONCE.*?$[\r\n]?)`,
 		syntax: `
 // #GOGP_ONCE 
@@ -251,19 +248,22 @@ var allSyntax = []*syntax{
 	&syntax{
 		ignoreInList: true,
 		name:         "#condition",
-		usage:        "txt that for #if or #case condition field parser.",
-		expr:         `(?sm:^[ \t]*(?P<NOT>!)?[ \t]*(?P<KEY>[[:word:]<>]+)[ \t]*(?:(?P<OP>==|!=)[ \t]*(?P<VALUE>[[:word:]]+))?[ \t]*)`,
+		usage:        "condition of #if, #elif and #case. Operands are keys or values, == and != compare value of a key, a single key of #case is compared with value of switch key which is an operand too, || && ! and parentheses combine them. Names can be dotted like time.Duration, and other values are quoted strings with escapes like \"*Person\".",
 		syntax: `
 <key> || !<key> || <key> == xxx || <key> != xxx || <SwitchKeyValue> || !<SwitchKeyValue>
+<key> && !(<key> == xxx || <key> != xxx)
+<key> == time.Duration || <key> == "*Person" || <key> == "map[string]int"
 `,
 	},
 }
 
 // syntax regexp descriptor
+// Blocks like #if and #switch, and conditions of them are parsed by parseGp of directive.go
+// and parseCondition of condition.go, so they have no expr, and describe the syntax only.
 type syntax struct {
 	name         string
 	usage        string
-	expr         string
+	expr         string //regexp of the syntax, empty if it is not parsed by regexp
 	syntax       string
 	ignoreInList bool
 }
@@ -273,7 +273,7 @@ func compileMultiRegexps(res ...*syntax) *regexp.Regexp {
 	var exp = `\Q#GOGP_DO_NOT_HAVE_ANY_REGEXP_SYNTAX#\E`
 	if len(res) > 0 {
 		for _, v := range res {
-			if !v.ignoreInList {
+			if !v.ignoreInList && v.expr != "" {
 				b.WriteString(v.expr)
 				b.WriteByte('|')
 			}
@@ -297,29 +297,16 @@ func findSyntax(name string) *syntax {
 		}
 	}
 	panic(fmt.Errorf("findSyntax(%s) not found", name))
-	return nil
 }
 
 var (
 	gogpExpTodoReplace   = findSyntax("#to-replace").MustCompile()
 	gogpExpIgnore        = findSyntax("#ignore").MustCompile()
-	gogpExpCases         = findSyntax("#case").MustCompile()
 	gogpExpEmptyLine     = findSyntax("#empty-line").MustCompile()
 	gogpExpTrimEmptyLine = findSyntax("#trim-empty-line").MustCompile()
 	gogpExpRequire       = findSyntax("#require").MustCompile()
-	gogpExpCondition     = findSyntax("#condition").MustCompile()
 	gogpExpComment       = findSyntax("#comment").MustCompile()
 
-	gogpExpCodeSelector = compileMultiRegexps(
-		findSyntax("#ignore"),
-		findSyntax("#gp-only"),
-		findSyntax("#map"),
-		findSyntax("#switch"),
-		findSyntax("#multi-switch"),
-		findSyntax("#if"),
-		findSyntax("#if2"),
-	)
-
 	gogpExpPretreatAll = compileMultiRegexps(
 		findSyntax("#ignore"),
 		findSyntax("#require"),
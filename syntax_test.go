@@ -31,37 +31,17 @@ func TestAllRegexpSyntax(t *testing.T) {
 		[]string{"match4", "0://#GOGP_IGNORE_BEGIN\n\t{ignore}\n//#GOGP_IGNORE_END\n\n", "IGNORE:\n\t{ignore}\n"},
 		[]string{"match5", "0:// #GOGP_REPLACE(<src>, <dst>)", "REPSRC:<src>", "REPDST:<dst>"},
 		[]string{"match6", "0://#GOGP_REPLACE(<src2>, <dst2>)", "REPSRC:<src2>", "REPDST:<dst2>"},
-		[]string{"match7", "0:// #GOGP_IFDEF <key> || ! <key> || <key> == xxx || <key> != xxx\n\t{if-true content}\n// #GOGP_ELSE\n\t{if-else content}\n// #GOGP_ENDIF\n", "IFCOND,1,2:<key>", "IFCOND,2,1:!", "IFCOND,2,2:<key>", "IFCOND,3,2:<key>", "IFCOND,3,3:==", "IFCOND,3,4:xxx", "IFCOND,4,2:<key>", "IFCOND,4,3:!=", "IFCOND,4,4:xxx", "IFT:\t{if-true content}\n", "IFF:\t{if-else content}\n"},
-		[]string{"match8", "0:// #GOGP_IFDEF <key> || ! <key> || <key> == xxx || <key> != xxx\n\t{if-true content2}\n// #GOGP_ENDIF\n", "IFCOND,1,2:<key>", "IFCOND,2,1:!", "IFCOND,2,2:<key>", "IFCOND,3,2:<key>", "IFCOND,3,3:==", "IFCOND,3,4:xxx", "IFCOND,4,2:<key>", "IFCOND,4,3:!=", "IFCOND,4,4:xxx", "IFT:\t{if-true content2}\n"},
-		[]string{"match9", "0://#GOGP_IFDEF <key> || ! <key> || <key> == xxx || <key> != xxx\n\t{if-true content}\n//#GOGP_ELSE\n\t{if-else content}\n//#GOGP_ENDIF\n", "IFCOND,1,2:<key>", "IFCOND,2,1:!", "IFCOND,2,2:<key>", "IFCOND,3,2:<key>", "IFCOND,3,3:==", "IFCOND,3,4:xxx", "IFCOND,4,2:<key>", "IFCOND,4,3:!=", "IFCOND,4,4:xxx", "IFT:\t{if-true content}\n", "IFF:\t{if-else content}\n"},
-		[]string{"match10", "0://#GOGP_IFDEF <key> || ! <key> || <key> == xxx || <key> != xxx\n\t{if-true content2}\n//#GOGP_ENDIF\n", "IFCOND,1,2:<key>", "IFCOND,2,1:!", "IFCOND,2,2:<key>", "IFCOND,3,2:<key>", "IFCOND,3,3:==", "IFCOND,3,4:xxx", "IFCOND,4,2:<key>", "IFCOND,4,3:!=", "IFCOND,4,4:xxx", "IFT:\t{if-true content2}\n"},
-		[]string{"match11", "0:// #GOGP_IFDEF x\n//     #GOGP_IFDEF2 yyy\n\t{if-true content}\n//     #GOGP_ELSE2\n\t{if-else content}\n//     #GOGP_ENDIF2\n// #GOGP_ELSE\n//     #GOGP_IFDEF2 yyy\n\t{if-true content}\n//     #GOGP_ELSE2\n\t{if-else content}\n//     #GOGP_ENDIF2\n// #GOGP_ENDIF\n", "IFCOND,1,2:x", "IFT://     #GOGP_IFDEF2 yyy\n\t{if-true content}\n//     #GOGP_ELSE2\n\t{if-else content}\n//     #GOGP_ENDIF2\n", "IFF://     #GOGP_IFDEF2 yyy\n\t{if-true content}\n//     #GOGP_ELSE2\n\t{if-else content}\n//     #GOGP_ENDIF2\n"},
-		[]string{"match12", "0:// #GOGP_IFDEF2 xx\n//     #GOGP_IFDEF yyy\n\t      {if-true content}\n//     #GOGP_ELSE //\n\t      {if-else content}\n//     #GOGP_ENDIF //\n// #GOGP_ELSE2\n//     #GOGP_IFDEF yyy\n\t      {if-true content}\n//     #GOGP_ELSE\n\t      {if-else content}\n//     #GOGP_ENDIF //\n// #GOGP_ENDIF2\n", "IFCOND2,1,2:xx", "IFT2://     #GOGP_IFDEF yyy\n\t      {if-true content}\n//     #GOGP_ELSE //\n\t      {if-else content}\n//     #GOGP_ENDIF //\n", "IFF2://     #GOGP_IFDEF yyy\n\t      {if-true content}\n//     #GOGP_ELSE\n\t      {if-else content}\n//     #GOGP_ENDIF //\n"},
-		[]string{"match13", "0:// #GOGP_SWITCH <SwitchKey>\n//    #GOGP_CASE <SwitchKeyValue1>\n        {case content1}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <SwitchKeyValue2>\n        {case content2}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content1}\n//    #GOGP_ENDCASE\n// #GOGP_ENDSWITCH\n", "SWITCHKEY:<SwitchKey>", "SWITCHCONTENT,1:<SwitchKeyValue1>", "SWITCHCONTENT,2:        {case content1}\n", "SWITCHCONTENT,1:<SwitchKeyValue2>", "SWITCHCONTENT,2:        {case content2}\n", "SWITCHCONTENT,2:        {default content1}\n"},
-		[]string{"match14", "0:// #GOGP_SWITCH\n//    #GOGP_CASE <key>\n        {case content3}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <key> != val\n        {case content4}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content2}\n//    #GOGP_ENDCASE\n// #GOGP_ENDSWITCH\n", "SWITCHCONTENT,1:<key>", "SWITCHCONTENT,2:        {case content3}\n", "SWITCHCONTENT,1:<key>", "SWITCHCONTENT,2:        {case content4}\n", "SWITCHCONTENT,2:        {default content2}\n"},
-		[]string{"match15", "0://#GOGP_SWITCH <SwitchKey>\n//    #GOGP_CASE <SwitchKeyValue1>\n        {case content1}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <SwitchKeyValue2>\n        {case content2}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content1}\n//    #GOGP_ENDCASE\n//#GOGP_ENDSWITCH\n", "SWITCHKEY:<SwitchKey>", "SWITCHCONTENT,1:<SwitchKeyValue1>", "SWITCHCONTENT,2:        {case content1}\n", "SWITCHCONTENT,1:<SwitchKeyValue2>", "SWITCHCONTENT,2:        {case content2}\n", "SWITCHCONTENT,2:        {default content1}\n"},
-		[]string{"match16", "0://#GOGP_SWITCH \n//    #GOGP_CASE <key>\n        {case content3}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <key> != val\n        {case content4}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content2}\n//    #GOGP_ENDCASE\n//#GOGP_ENDSWITCH\n", "SWITCHCONTENT,1:<key>", "SWITCHCONTENT,2:        {case content3}\n", "SWITCHCONTENT,1:<key>", "SWITCHCONTENT,2:        {case content4}\n", "SWITCHCONTENT,2:        {default content2}\n"},
-		[]string{"match17", "0:// #GOGP_MULTISWITCH <SwitchKey>\n//    #GOGP_CASE <SwitchKeyValue1>\n        {case content1}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <SwitchKeyValue2>\n        {case content2}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content1}\n//    #GOGP_ENDCASE\n// #GOGP_ENDMULTISWITCH\n", "MULTISWITCHKEY:<SwitchKey>", "MULTISWITCHCONTENT,1:<SwitchKeyValue1>", "MULTISWITCHCONTENT,2:        {case content1}\n", "MULTISWITCHCONTENT,1:<SwitchKeyValue2>", "MULTISWITCHCONTENT,2:        {case content2}\n", "MULTISWITCHCONTENT,2:        {default content1}\n"},
-		[]string{"match18", "0:// #GOGP_MULTISWITCH\n//    #GOGP_CASE <key>\n        {case content3}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <key> != val\n        {case content4}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content2}\n//    #GOGP_ENDCASE\n// #GOGP_ENDMULTISWITCH\n", "MULTISWITCHCONTENT,1:<key>", "MULTISWITCHCONTENT,2:        {case content3}\n", "MULTISWITCHCONTENT,1:<key>", "MULTISWITCHCONTENT,2:        {case content4}\n", "MULTISWITCHCONTENT,2:        {default content2}\n"},
-		[]string{"match19", "0://#GOGP_MULTISWITCH <SwitchKey>\n//    #GOGP_CASE <SwitchKeyValue1>\n        {case content1}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <SwitchKeyValue2>\n        {case content2}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content1}\n//    #GOGP_ENDCASE\n//#GOGP_ENDMULTISWITCH\n", "MULTISWITCHKEY:<SwitchKey>", "MULTISWITCHCONTENT,1:<SwitchKeyValue1>", "MULTISWITCHCONTENT,2:        {case content1}\n", "MULTISWITCHCONTENT,1:<SwitchKeyValue2>", "MULTISWITCHCONTENT,2:        {case content2}\n", "MULTISWITCHCONTENT,2:        {default content1}\n"},
-		[]string{"match20", "0://#GOGP_MULTISWITCH \n//    #GOGP_CASE <key>\n        {case content3}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <key> != val\n        {case content4}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content2}\n//    #GOGP_ENDCASE\n//#GOGP_ENDMULTISWITCH\n", "MULTISWITCHCONTENT,1:<key>", "MULTISWITCHCONTENT,2:        {case content3}\n", "MULTISWITCHCONTENT,1:<key>", "MULTISWITCHCONTENT,2:        {case content4}\n", "MULTISWITCHCONTENT,2:        {default content2}\n"},
-		[]string{"match21", "0://    #GOGP_CASE <key>\n        {case content3}\n//    #GOGP_ENDCASE\n", "CASEKEY,1,2:<key>", "CASECONTENT:        {case content3}\n"},
-		[]string{"match22", "0://    #GOGP_CASE <key> != val\n        {case content4}\n//    #GOGP_ENDCASE\n", "CASEKEY,1,2:<key>", "CASECONTENT:        {case content4}\n"},
-		[]string{"match23", "0://    #GOGP_DEFAULT\n        {default content2}\n//    #GOGP_ENDCASE\n\n", "CASECONTENT:        {default content2}\n"},
-		[]string{"match24", "0://#GOGP_CASE <key>\n        {case content3}\n//#GOGP_ENDCASE\n", "CASEKEY,1,2:<key>", "CASECONTENT:        {case content3}\n"},
-		[]string{"match25", "0://#GOGP_CASE <key> != val\n        {case content4}\n//#GOGP_ENDCASE\n", "CASEKEY,1,2:<key>", "CASECONTENT:        {case content4}\n"},
-		[]string{"match26", "0://#GOGP_DEFAULT\n        {default content2}\n//#GOGP_ENDCASE\n\n", "CASECONTENT:        {default content2}\n"},
-		[]string{"match27", "0:// #GOGP_REQUIRE(<gp-path> , gpgSection)\n\n", "REQ:// #GOGP_REQUIRE(<gp-path> , gpgSection)", "REQP:<gp-path>", "REQN:gpgSection"},
-		[]string{"match28", "0:#GOGP_GPGCFG(<config-name>)", "GPGCFG:<config-name>"},
-		[]string{"match29", "0:// #GOGP_REPLACE(<src>, <dst>)", "REPSRC:<src>", "REPDST:<dst>"},
-		[]string{"match30", "0:// #GOGP_MAP(<src>, <dst>)", "MAPSRC:<src>", "MAPDST:<dst>"},
-		[]string{"match31", "0:// #GOGP_IGNORE_BEGIN \n     {ignore content} \n// #GOGP_IGNORE_END\n\n", "IGNORE: \n     {ignore content} \n// "},
-		[]string{"match32", "0:// #GOGP_GPONLY_BEGIN \n     {gp-only content} \n// #GOGP_GPONLY_END\n\n", "GPONLY: \n     {gp-only content} \n// "},
-		[]string{"match33", "0:// #GOGP_FILE_BEGIN\n\n", "FILEB:// #GOGP_FILE_BEGIN"},
-		[]string{"match34", "0:// #GOGP_FILE_END\n\n", "FILEE:// #GOGP_FILE_END"},
-		[]string{"match35", "0:// #GOGP_ONCE \n    {only generate once from a gp file} \n// #GOGP_END_ONCE \n", "ONCE: \n    {only generate once from a gp file} "},
-		[]string{"match36", "0:\n\n\n\n\n\n\n", "EMPTY_LINE:\n\n\n\n\n\n\n"},
-		[]string{"match37", "0:\n\n\n", "EMPTY_LINE:\n\n\n"},
+		[]string{"match7", "0:// #GOGP_REQUIRE(<gp-path> , gpgSection)\n\n", "REQ:// #GOGP_REQUIRE(<gp-path> , gpgSection)", "REQP:<gp-path>", "REQN:gpgSection"},
+		[]string{"match8", "0:#GOGP_GPGCFG(<config-name>)", "GPGCFG:<config-name>"},
+		[]string{"match9", "0:// #GOGP_REPLACE(<src>, <dst>)", "REPSRC:<src>", "REPDST:<dst>"},
+		[]string{"match10", "0:// #GOGP_MAP(<src>, <dst>)", "MAPSRC:<src>", "MAPDST:<dst>"},
+		[]string{"match11", "0:// #GOGP_IGNORE_BEGIN \n     {ignore content} \n// #GOGP_IGNORE_END\n\n", "IGNORE: \n     {ignore content} \n// "},
+		[]string{"match12", "0:// #GOGP_GPONLY_BEGIN \n     {gp-only content} \n// #GOGP_GPONLY_END\n\n", "GPONLY: \n     {gp-only content} \n// "},
+		[]string{"match13", "0:// #GOGP_FILE_BEGIN\n\n", "FILEB:// #GOGP_FILE_BEGIN"},
+		[]string{"match14", "0:// #GOGP_FILE_END\n\n", "FILEE:// #GOGP_FILE_END"},
+		[]string{"match15", "0:// #GOGP_ONCE \n    {only generate once from a gp file} \n// #GOGP_END_ONCE \n", "ONCE: \n    {only generate once from a gp file} "},
+		[]string{"match16", "0:\n\n\n\n\n\n\n", "EMPTY_LINE:\n\n\n\n\n\n\n"},
+		[]string{"match17", "0:\n\n\n", "EMPTY_LINE:\n\n\n"},
 	}
 
 	var submatches [][]string
@@ -78,39 +58,7 @@ func TestAllRegexpSyntax(t *testing.T) {
 				if testPrintResult {
 					fmt.Printf("%d %s-------\n%s\n", i, v, elem[i])
 				}
-				switch v {
-				case "CASEKEY", "IFCOND", "IFCOND2":
-					ss := strings.Split(elem[i], "||")
-					for j, vv := range ss {
-						c := gogpExpCondition.FindAllStringSubmatch(vv, -1)[0]
-						for k, v := range c {
-							if testPrintResult {
-								fmt.Println(j, k, v)
-							}
-							if v != "" && i > 0 && k > 0 {
-								subs = append(subs, fmt.Sprintf("%s,%d,%d:%s", groups[i], j+1, k, v))
-							}
-						}
-					}
-				case "SWITCHCONTENT", "MULTISWITCHCONTENT":
-					rep := gogpExpCases.ReplaceAllStringFunc(elem[i], func(src string) string {
-						cases := gogpExpCases.FindAllStringSubmatch(src, -1)[0]
-						if testPrintResult {
-							fmt.Printf("case: %#v\n", cases)
-						}
-						for j, v := range cases {
-							if v != "" && i > 0 && j > 0 {
-								subs = append(subs, fmt.Sprintf("%s,%d:%s", groups[i], j, v))
-							}
-						}
-						return ""
-					})
-					if testPrintResult {
-						fmt.Println(rep)
-					}
-				default:
-					subs = append(subs, fmt.Sprintf("%s:%s", groups[i], elem[i]))
-				}
+				subs = append(subs, fmt.Sprintf("%s:%s", groups[i], elem[i]))
 			}
 		}
 
@@ -134,13 +82,11 @@ func TestAllRegexpSyntax(t *testing.T) {
 
 func TestMultiRegexp(t *testing.T) {
 	var subNamesExpected = [][]string{
-		[]string{"", "IGNORE", "GPONLY", "MAPSRC", "MAPDST", "SWITCHKEY", "SWITCHCONTENT", "MULTISWITCHKEY", "MULTISWITCHCONTENT", "IFCOND", "IFT", "IFF", "IFCOND2", "IFT2", "IFF2"},
 		[]string{"", "IGNORE", "REQ", "REQP", "REQN", "REQGPG", "REQCONTENT", "GPGCFG", "ONCE", "REPSRC", "REPDST", "COMMENT"},
 		[]string{"", "REQ", "REQP", "REQN", "REQGPG", "REQCONTENT", "FILEB", "OPEN", "FILEE"},
 		[]string{"", "FILEB", "OPEN", "FILEE", "IGNORE"},
 	}
 	var subNames = [][]string{
-		gogpExpCodeSelector.SubexpNames(),
 		gogpExpPretreatAll.SubexpNames(),
 		gogpExpRequireAll.SubexpNames(),
 		gogpExpReverseIgnoreAll.SubexpNames(),
@@ -172,11 +118,6 @@ func TestSingleRegexps(t *testing.T) {
 			syntax: gogpExpIgnore,
 			name:   "gogpExpIgnore",
 		},
-		&testCase{
-			expect: []string{"<SwitchKeyValue1>", "<SwitchKeyValue2>", "", "<key>", "<key>", "", "<SwitchKeyValue1>", "<SwitchKeyValue2>", "", "<key>", "<key>", "", "<SwitchKeyValue1>", "<SwitchKeyValue2>", "", "<key>", "<key>", "", "<SwitchKeyValue1>", "<SwitchKeyValue2>", "", "<key>", "<key>", "", "<key>", "<key>", "", "<key>", "<key>", ""},
-			syntax: gogpExpCases,
-			name:   "gogpExpCases",
-		},
 		&testCase{
 			expect: []string{"\n\n\n", "\n\n\n\n\n\n\n", "\n\n\n"},
 			syntax: gogpExpEmptyLine,
@@ -192,11 +133,6 @@ func TestSingleRegexps(t *testing.T) {
 			syntax: gogpExpRequire,
 			name:   "gogpExpRequire",
 		},
-		&testCase{
-			expect: []string{"", ""},
-			syntax: gogpExpCondition,
-			name:   "gogpExpCondition",
-		},
 		&testCase{
 			expect: []string{"// #GOGP_COMMENT", "//#GOGP_COMMENT"},
 			syntax: gogpExpComment,
@@ -498,3 +434,189 @@ tail
 
 
 `
+
+// testNodeText makes source text of nodes
+func testNodeText(nodes []*gpNode) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		b.WriteString(n.tok.text)
+		b.WriteString(testNodeText(n.body))
+		b.WriteString(testNodeText(n.elifs))
+		if n.els != nil {
+			b.WriteString(n.els.text)
+			b.WriteString(testNodeText(n.elseBody))
+		}
+		b.WriteString(testNodeText(n.cases))
+		if n.end != nil {
+			b.WriteString(n.end.text)
+		}
+	}
+	return b.String()
+}
+
+// testBlockSyntax shows blocks of nodes like submatches of the regexps that parsed them before
+func testBlockSyntax(nodes []*gpNode) (l []string) {
+	for _, n := range nodes {
+		switch n.tok.kind {
+		case tokIf:
+			suffix := strings.TrimPrefix(n.tok.name, "IFDEF")
+			l = append(l, "IFCOND"+suffix+":"+testCondString(n.tok.cond), "IFT"+suffix+":"+testNodeText(n.body))
+			for _, e := range n.elifs {
+				l = append(l, "ELIFCOND"+suffix+":"+testCondString(e.tok.cond), "ELIFT"+suffix+":"+testNodeText(e.body))
+			}
+			if n.els != nil {
+				l = append(l, "IFF"+suffix+":"+testNodeText(n.elseBody))
+			}
+		case tokSwitch:
+			if n.tok.arg != "" {
+				l = append(l, n.tok.name+"KEY:"+n.tok.arg)
+			}
+			for _, c := range n.cases {
+				if c.tok.kind == tokCase {
+					l = append(l, "CASEKEY:"+testCondString(c.tok.cond))
+				}
+				l = append(l, "CASECONTENT:"+testNodeText(c.body))
+			}
+		}
+	}
+	return
+}
+
+func TestBlockSyntax(t *testing.T) {
+	//inputs of blocks that were matched by regexps before the directive parser replaced them
+	var tests = []struct {
+		name   string
+		input  string
+		expect []string
+	}{
+		{
+			"match7",
+			"// #GOGP_IFDEF <key> || ! <key> || <key> == xxx || <key> != xxx\n\t{if-true content}\n// #GOGP_ELSE\n\t{if-else content}\n// #GOGP_ENDIF\n",
+			[]string{"IFCOND:(|| (|| (|| <key> (! <key>)) (== <key> xxx)) (!= <key> xxx))", "IFT:\t{if-true content}\n", "IFF:\t{if-else content}\n"},
+		},
+		{
+			"match8",
+			"// #GOGP_IFDEF <key> || ! <key> || <key> == xxx || <key> != xxx\n\t{if-true content2}\n// #GOGP_ENDIF\n",
+			[]string{"IFCOND:(|| (|| (|| <key> (! <key>)) (== <key> xxx)) (!= <key> xxx))", "IFT:\t{if-true content2}\n"},
+		},
+		{
+			"match9",
+			"//#GOGP_IFDEF <key> || ! <key> || <key> == xxx || <key> != xxx\n\t{if-true content}\n//#GOGP_ELSE\n\t{if-else content}\n//#GOGP_ENDIF\n",
+			[]string{"IFCOND:(|| (|| (|| <key> (! <key>)) (== <key> xxx)) (!= <key> xxx))", "IFT:\t{if-true content}\n", "IFF:\t{if-else content}\n"},
+		},
+		{
+			"match10",
+			"//#GOGP_IFDEF <key> || ! <key> || <key> == xxx || <key> != xxx\n\t{if-true content2}\n//#GOGP_ENDIF\n",
+			[]string{"IFCOND:(|| (|| (|| <key> (! <key>)) (== <key> xxx)) (!= <key> xxx))", "IFT:\t{if-true content2}\n"},
+		},
+		{
+			"match11",
+			"// #GOGP_IFDEF x\n//     #GOGP_IFDEF2 yyy\n\t{if-true content}\n//     #GOGP_ELSE2\n\t{if-else content}\n//     #GOGP_ENDIF2\n// #GOGP_ELSE\n//     #GOGP_IFDEF2 yyy\n\t{if-true content}\n//     #GOGP_ELSE2\n\t{if-else content}\n//     #GOGP_ENDIF2\n// #GOGP_ENDIF\n",
+			[]string{"IFCOND:x", "IFT://     #GOGP_IFDEF2 yyy\n\t{if-true content}\n//     #GOGP_ELSE2\n\t{if-else content}\n//     #GOGP_ENDIF2\n", "IFF://     #GOGP_IFDEF2 yyy\n\t{if-true content}\n//     #GOGP_ELSE2\n\t{if-else content}\n//     #GOGP_ENDIF2\n"},
+		},
+		{
+			"match12",
+			"// #GOGP_IFDEF2 xx\n//     #GOGP_IFDEF yyy\n\t      {if-true content}\n//     #GOGP_ELSE //\n\t      {if-else content}\n//     #GOGP_ENDIF //\n// #GOGP_ELSE2\n//     #GOGP_IFDEF yyy\n\t      {if-true content}\n//     #GOGP_ELSE\n\t      {if-else content}\n//     #GOGP_ENDIF //\n// #GOGP_ENDIF2\n",
+			[]string{"IFCOND2:xx", "IFT2://     #GOGP_IFDEF yyy\n\t      {if-true content}\n//     #GOGP_ELSE //\n\t      {if-else content}\n//     #GOGP_ENDIF //\n", "IFF2://     #GOGP_IFDEF yyy\n\t      {if-true content}\n//     #GOGP_ELSE\n\t      {if-else content}\n//     #GOGP_ENDIF //\n"},
+		},
+		{
+			"match13",
+			"// #GOGP_SWITCH <SwitchKey>\n//    #GOGP_CASE <SwitchKeyValue1>\n        {case content1}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <SwitchKeyValue2>\n        {case content2}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content1}\n//    #GOGP_ENDCASE\n// #GOGP_ENDSWITCH\n",
+			[]string{"SWITCHKEY:SwitchKey", "CASEKEY:<SwitchKeyValue1>", "CASECONTENT:        {case content1}\n", "CASEKEY:<SwitchKeyValue2>", "CASECONTENT:        {case content2}\n", "CASECONTENT:        {default content1}\n"},
+		},
+		{
+			"match14",
+			"// #GOGP_SWITCH\n//    #GOGP_CASE <key>\n        {case content3}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <key> != val\n        {case content4}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content2}\n//    #GOGP_ENDCASE\n// #GOGP_ENDSWITCH\n",
+			[]string{"CASEKEY:<key>", "CASECONTENT:        {case content3}\n", "CASEKEY:(!= <key> val)", "CASECONTENT:        {case content4}\n", "CASECONTENT:        {default content2}\n"},
+		},
+		{
+			"match15",
+			"//#GOGP_SWITCH <SwitchKey>\n//    #GOGP_CASE <SwitchKeyValue1>\n        {case content1}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <SwitchKeyValue2>\n        {case content2}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content1}\n//    #GOGP_ENDCASE\n//#GOGP_ENDSWITCH\n",
+			[]string{"SWITCHKEY:SwitchKey", "CASEKEY:<SwitchKeyValue1>", "CASECONTENT:        {case content1}\n", "CASEKEY:<SwitchKeyValue2>", "CASECONTENT:        {case content2}\n", "CASECONTENT:        {default content1}\n"},
+		},
+		{
+			"match16",
+			"//#GOGP_SWITCH \n//    #GOGP_CASE <key>\n        {case content3}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <key> != val\n        {case content4}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content2}\n//    #GOGP_ENDCASE\n//#GOGP_ENDSWITCH\n",
+			[]string{"CASEKEY:<key>", "CASECONTENT:        {case content3}\n", "CASEKEY:(!= <key> val)", "CASECONTENT:        {case content4}\n", "CASECONTENT:        {default content2}\n"},
+		},
+		{
+			"match17",
+			"// #GOGP_MULTISWITCH <SwitchKey>\n//    #GOGP_CASE <SwitchKeyValue1>\n        {case content1}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <SwitchKeyValue2>\n        {case content2}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content1}\n//    #GOGP_ENDCASE\n// #GOGP_ENDMULTISWITCH\n",
+			[]string{"MULTISWITCHKEY:SwitchKey", "CASEKEY:<SwitchKeyValue1>", "CASECONTENT:        {case content1}\n", "CASEKEY:<SwitchKeyValue2>", "CASECONTENT:        {case content2}\n", "CASECONTENT:        {default content1}\n"},
+		},
+		{
+			"match18",
+			"// #GOGP_MULTISWITCH\n//    #GOGP_CASE <key>\n        {case content3}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <key> != val\n        {case content4}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content2}\n//    #GOGP_ENDCASE\n// #GOGP_ENDMULTISWITCH\n",
+			[]string{"CASEKEY:<key>", "CASECONTENT:        {case content3}\n", "CASEKEY:(!= <key> val)", "CASECONTENT:        {case content4}\n", "CASECONTENT:        {default content2}\n"},
+		},
+		{
+			"match19",
+			"//#GOGP_MULTISWITCH <SwitchKey>\n//    #GOGP_CASE <SwitchKeyValue1>\n        {case content1}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <SwitchKeyValue2>\n        {case content2}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content1}\n//    #GOGP_ENDCASE\n//#GOGP_ENDMULTISWITCH\n",
+			[]string{"MULTISWITCHKEY:SwitchKey", "CASEKEY:<SwitchKeyValue1>", "CASECONTENT:        {case content1}\n", "CASEKEY:<SwitchKeyValue2>", "CASECONTENT:        {case content2}\n", "CASECONTENT:        {default content1}\n"},
+		},
+		{
+			"match20",
+			"//#GOGP_MULTISWITCH \n//    #GOGP_CASE <key>\n        {case content3}\n//    #GOGP_ENDCASE\n//    #GOGP_CASE <key> != val\n        {case content4}\n//    #GOGP_ENDCASE\n//    #GOGP_DEFAULT\n        {default content2}\n//    #GOGP_ENDCASE\n//#GOGP_ENDMULTISWITCH\n",
+			[]string{"CASEKEY:<key>", "CASECONTENT:        {case content3}\n", "CASEKEY:(!= <key> val)", "CASECONTENT:        {case content4}\n", "CASECONTENT:        {default content2}\n"},
+		},
+		{
+			"match21",
+			"//#GOGP_SWITCH\n//    #GOGP_CASE <key>\n        {case content3}\n//    #GOGP_ENDCASE\n//#GOGP_ENDSWITCH\n",
+			[]string{"CASEKEY:<key>", "CASECONTENT:        {case content3}\n"},
+		},
+		{
+			"match22",
+			"//#GOGP_SWITCH\n//    #GOGP_CASE <key> != val\n        {case content4}\n//    #GOGP_ENDCASE\n//#GOGP_ENDSWITCH\n",
+			[]string{"CASEKEY:(!= <key> val)", "CASECONTENT:        {case content4}\n"},
+		},
+		{
+			"match23",
+			"//#GOGP_SWITCH\n//    #GOGP_DEFAULT\n        {default content2}\n//    #GOGP_ENDCASE\n\n//#GOGP_ENDSWITCH\n",
+			[]string{"CASECONTENT:        {default content2}\n"},
+		},
+		{
+			"match24",
+			"//#GOGP_SWITCH\n//#GOGP_CASE <key>\n        {case content3}\n//#GOGP_ENDCASE\n//#GOGP_ENDSWITCH\n",
+			[]string{"CASEKEY:<key>", "CASECONTENT:        {case content3}\n"},
+		},
+		{
+			"match25",
+			"//#GOGP_SWITCH\n//#GOGP_CASE <key> != val\n        {case content4}\n//#GOGP_ENDCASE\n//#GOGP_ENDSWITCH\n",
+			[]string{"CASEKEY:(!= <key> val)", "CASECONTENT:        {case content4}\n"},
+		},
+		{
+			"match26",
+			"//#GOGP_SWITCH\n//#GOGP_DEFAULT\n        {default content2}\n//#GOGP_ENDCASE\n\n//#GOGP_ENDSWITCH\n",
+			[]string{"CASECONTENT:        {default content2}\n"},
+		},
+	}
+	var caseKeys []string
+	for _, tt := range tests {
+		nodes, err := parseGp("block.gp", tt.input)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := testNodeText(nodes); got != tt.input {
+			t.Errorf("%s: source text not kept\n%q", tt.name, got)
+		}
+		if err := testCheckStrings(testBlockSyntax(nodes), tt.expect); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		for _, n := range nodes {
+			for _, c := range n.cases {
+				key := ""
+				for x := c.tok.cond; x != nil; x = x.x {
+					key = x.value
+				}
+				caseKeys = append(caseKeys, key)
+			}
+		}
+	}
+
+	//first key of each case in order, empty for #GOGP_DEFAULT
+	expectKeys := []string{"<SwitchKeyValue1>", "<SwitchKeyValue2>", "", "<key>", "<key>", "", "<SwitchKeyValue1>", "<SwitchKeyValue2>", "", "<key>", "<key>", "", "<SwitchKeyValue1>", "<SwitchKeyValue2>", "", "<key>", "<key>", "", "<SwitchKeyValue1>", "<SwitchKeyValue2>", "", "<key>", "<key>", "", "<key>", "<key>", "", "<key>", "<key>", ""}
+	if err := testCheckStrings(caseKeys, expectKeys); err != nil {
+		t.Errorf("case keys: %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+// MIT License
+//
+// Copyright (c) 2021 @gxlb
+// Url:
+//     https://github.com/gxlb
+//     https://gitee.com/gxlb
+// AUTHORS:
+//     Ally Dale <vipally@gamil.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gogp
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WorkFile gen code from a single gpg file, and report result of every section and product.
+// It runs the same steps as Work.
+func (r *Runner) WorkFile(gpg string) (*Report, error) {
+	return r.WorkSection(gpg, "")
+}
+
+// WorkSection gen code from a section of gpg file, and report result of every product.
+// Sections it depends on are processed too, that is GOGP_REVERSE sections which generate gp files it uses,
+// including gp files required by #GOGP_REQUIRE. They are found in gpg files under the same data root
+// (module root, or dir of gpg file), or by provenance of the generated gp files.
+// It works as WorkFile if section is empty.
+// Relative path of gpg file is related to working path if it exists there, otherwise to GoPath.
+func (r *Runner) WorkSection(gpg, section string) (rpt *Report, err error) {
+	start := time.Now()
+	r.reset()
+
+	gpg = targetPath(r.fsys, gpg)
+	rpt = &Report{Dir: filepath.ToSlash(filepath.Dir(gpg)), InMemory: r.inMemory(), fsys: r.fsys}
+	list := []string{gpg}
+	if _, err = r.fsys.Stat(gpg); err == nil && section != "" {
+		r.sections, list, err = r.sectionDeps(gpg, section)
+	}
+	dirs := make([]string, 0, len(list))
+	for _, f := range list {
+		dirs = append(dirs, filepath.Dir(f))
+	}
+	r.lockRoots(dirs...)
+	r.openCache(dirs[0])
+	r.openManifest(dirs[0])
+	if err == nil {
+		r.log(LevelInfo, "working at", Field{"path", relateGoPath(r.fsys, gpg)})
+		r.process(list, rpt)
+	}
+	r.finish(start, rpt)
+
+	return
+}
+
+// WorkFile gen code from a single gpg file with config set by package level functions.
+func WorkFile(gpg string) (*Report, error) {
+	return NewRunner(defaultConfig).WorkFile(gpg)
+}
+
+// WorkSection gen code from a section of gpg file and sections it depends on,
+// with config set by package level functions.
+func WorkSection(gpg, section string) (*Report, error) {
+	return NewRunner(defaultConfig).WorkSection(gpg, section)
+}
+
+// split target like "path/to/file.gpg" or "path/to/file.gpg:section"
+func splitTarget(target string) (gpg, section string, ok bool) {
+	if strings.HasSuffix(target, gpgExt) {
+		return target, "", true
+	}
+	if i := strings.LastIndex(target, gpgExt+":"); i > 0 {
+		return target[:i+len(gpgExt)], target[i+len(gpgExt)+1:], true
+	}
+	return
+}
+
+// get full path of target, relative path is related to working path if it exists there
+func targetPath(fsys FileSystem, path string) string {
+	if !filepath.IsAbs(path) {
+		p := filepath.Join(workPath(), path)
+		if _, err := fsys.Stat(p); err == nil {
+			return filepath.ToSlash(p)
+		}
+	}
+	return formatPath(path)
+}
+
+// key of a section of gpg file in Runner.sections
+func sectionKey(gpg, section string) string {
+	return gpg + ":" + section
+}
+
+// find sections that section of gpg file depends on, including itself, keyed by sectionKey,
+// and gpg files of them, gpg comes first.
+// GOGP_REVERSE sections are found by gp files they generate,
+// which are used by section directly or required by #GOGP_REQUIRE.
+// A gp file is generated by GOGP_REVERSE section of gpg files under data root of gpg,
+// or by the section told by its provenance, it is an error if that section does not exist.
+func (r *Runner) sectionDeps(gpg, section string) (deps map[string]bool, gpgs []string, err error) {
+	procs := make(map[string]*gopgProcessor) //gpg file => processor that has loaded it
+	load := func(file string) (*gopgProcessor, error) {
+		if p, ok := procs[file]; ok {
+			return p, nil
+		}
+		p := &gopgProcessor{runner: r, report: &Report{fsys: r.fsys}, logger: discardLogger{}}
+		if err := p.loadGpgFile(file); err != nil {
+			return nil, err
+		}
+		procs[file], gpgs = p, append(gpgs, file)
+		return p, nil
+	}
+	p, err := load(formatPath(gpg))
+	if err != nil {
+		return
+	}
+	gpg = p.gpgPath
+	if p.gpgContent.Keys(section) == nil {
+		err = p.newError("", "", fmt.Errorf("%w [%s]", ErrMissingSection, section))
+		return
+	}
+
+	type dep struct {
+		gpg     string
+		section string //section to depend on, or context section of file
+		file    string //file to scan for #GOGP_REQUIRE, empty for a section
+	}
+	owners := make(map[string]dep) //gp file => GOGP_REVERSE section that generates it
+	addOwners := func(p *gopgProcessor) {
+		for _, sec := range p.gpgContent.Sections() {
+			if strings.HasPrefix(sec, txtSectionReverse) {
+				p.section = sec
+				gp := ""
+				if name, e := p.getGpName(); e == nil {
+					gp = filepath.ToSlash(filepath.Join(filepath.Dir(p.gpgPath), name+gpExt))
+				}
+				if _, ok := owners[gp]; !ok && gp != "" { //sections of gpg come first
+					owners[gp] = dep{gpg: p.gpgPath, section: sec}
+				}
+			}
+		}
+	}
+	addOwners(p)
+	w := &walker{fsys: r.fsys, ext: gpgExt, patterns: r.Excludes, warn: r.walkWarning}
+	files, err := w.collect(formatPath(dataRoot(r.fsys, filepath.Dir(gpg))))
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		if q, e := load(formatPath(f)); e == nil { //broken gpg files are reported when processing them
+			addOwners(q)
+		}
+	}
+	used := make(map[string]bool) //gpg files of deps
+	defer func() {
+		l := gpgs[:0]
+		for _, f := range gpgs {
+			if used[f] {
+				l = append(l, f)
+			}
+		}
+		gpgs = l
+	}()
+
+	deps = make(map[string]bool)
+	scanned := make(map[dep]bool)
+	for queue := []dep{{gpg: gpg, section: section}}; len(queue) > 0; queue = queue[1:] {
+		d := queue[0]
+		p := procs[d.gpg]
+		p.section = d.section
+		if d.file == "" { //a section, scan gp file or fake code file it uses
+			key := sectionKey(d.gpg, d.section)
+			if deps[key] {
+				continue
+			}
+			deps[key], used[d.gpg] = true, true
+			file := ""
+			if strings.HasPrefix(d.section, txtSectionReverse) {
+				if name, e := p.getGpName(); e == nil {
+					file = p.getFakeSrcFilePath(filepath.Join(filepath.Dir(d.gpg), name))
+				}
+			} else {
+				file, _ = p.getGpFullPath("")
+			}
+			if file != "" {
+				queue = append(queue, dep{d.gpg, d.section, filepath.ToSlash(file)})
+			}
+			continue
+		}
+
+		if scanned[d] {
+			continue
+		}
+		scanned[d] = true
+		content, e := p.rawLoadFile(d.file)
+		if owner, ok := owners[d.file]; ok {
+			queue = append(queue, owner)
+		} else if e == nil && filepath.Ext(d.file) == gpExt && isGenerated(content) { //generated out of data root
+			info, pe := r.Provenance(d.file)
+			if pe != nil && info != nil {
+				err = p.newError(d.file, "", fmt.Errorf("%w, which generates the gp file", pe))
+				return
+			}
+			if info != nil && strings.HasPrefix(info.Section, txtSectionReverse) {
+				if _, err = load(formatPath(info.Gpg)); err != nil {
+					return
+				}
+				queue = append(queue, dep{gpg: formatPath(info.Gpg), section: info.Section})
+			}
+		}
+		if e != nil { //missing files will be reported when processing
+			continue
+		}
+		for _, req := range p.requiredGpFiles(content, d.section) {
+			queue = append(queue, dep{d.gpg, req.section, req.gp})
+		}
+	}
+	return
+}
@@ -0,0 +1,644 @@
+package gogp
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const tstGpBox = `//#GOGP_IGNORE_BEGIN
+//this is a test gp file
+//#GOGP_IGNORE_END
+
+<PACKAGE>
+
+type <GLOBAL_NAME_PREFIX>Box struct {
+	v <VALUE_TYPE>
+}
+
+func (b *<GLOBAL_NAME_PREFIX>Box) Get() <VALUE_TYPE> {
+	return b.v
+}
+`
+
+const tstGpgBox = `;test gpg file
+[box_int]
+GOGP_GpFilePath=box
+PACKAGE=package demo
+VALUE_TYPE=int
+GLOBAL_NAME_PREFIX=Int
+
+[box_string]
+GOGP_GpFilePath=box
+PACKAGE=package demo
+VALUE_TYPE=string
+GLOBAL_NAME_PREFIX=String
+`
+
+// testGoPath makes a temp GoPath with files, which path is related to GoPath/src.
+func testGoPath(t *testing.T, files map[string]string) (src string) {
+	root := t.TempDir()
+	src = filepath.ToSlash(filepath.Join(root, "src")) + "/"
+	for name, content := range files {
+		testWriteFile(t, filepath.Join(src, name), content)
+	}
+	old := goPath
+	goPath = src
+	t.Cleanup(func() { goPath = old })
+	return
+}
+
+func testWriteFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testReadFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestWorkReport(t *testing.T) {
+	src := testGoPath(t, map[string]string{
+		"demo/box.gp":   tstGpBox,
+		"demo/box.gpg":  tstGpgBox,
+		"other/bad.gpg": "[bad]\nGOGP_GpFilePath=missing\n",
+	})
+
+	r, err := WorkReport("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := r.Count(StatusWritten); n != 2 || len(r.Failed()) != 0 {
+		t.Fatalf("written=%d failed=%v", n, r.Failed())
+	}
+	var entries []string //results of products, and then their section, and the gpg file at last
+	for _, e := range r.Entries {
+		entries = append(entries, e.Status.String()+" "+e.Section+" "+filepath.Base(e.Gp)+" "+filepath.Base(e.Target))
+	}
+	if want := []string{"written box_int box.gp box.gp_int.go", "done box_int box.gp .", "written box_string box.gp box.gp_string.go", "done box_string box.gp .", "done  . ."}; !reflect.DeepEqual(entries, want) {
+		t.Fatalf("entries: %q", entries)
+	}
+	if e := r.Entries[len(r.Entries)-1]; e.Gpg != src+"demo/box.gpg" || e.Step != StepProduce || e.String() != "done     [demo/box.gpg]" {
+		t.Fatalf("gpg entry: %#v %s", e, e)
+	}
+	code := testReadFile(t, src+"demo/box.gp_int.go")
+	if !strings.Contains(code, "func (b *IntBox) Get() int {") {
+		t.Errorf("unexpected product:\n%s", code)
+	}
+
+	if r, _ = WorkReport("demo"); r.Count(StatusSkipped) != 2 {
+		t.Errorf("second run should skip all products: %d", r.Count(StatusSkipped))
+	}
+
+	r, _ = WorkReport("other")
+	failed := r.Failed()
+	if len(failed) != 1 || failed[0].Section != "bad" || !errors.Is(failed[0].Err, os.ErrNotExist) {
+		t.Fatalf("unexpected failures: %v", failed)
+	}
+	var pe *ProcessError
+	if !errors.As(failed[0].Err, &pe) || pe.Step != StepProduce {
+		t.Errorf("unexpected error type: %#v", failed[0].Err)
+	}
+}
+
+func TestWorkReportNoReplacing(t *testing.T) {
+	testGoPath(t, map[string]string{
+		"demo/box.gp":  tstGpBox,
+		"demo/box.gpg": "[box_int]\nGOGP_GpFilePath=box\nPACKAGE=package demo\nVALUE_TYPE=int\n",
+	})
+	r, _ := WorkReport("demo")
+	failed := r.Failed()
+	if len(failed) != 1 || !errors.Is(failed[0].Err, ErrNoReplacing) {
+		t.Fatalf("unexpected failures: %v", failed)
+	}
+	if msg := failed[0].Err.Error(); !strings.HasSuffix(msg, " at demo/box.gp:7:6 <GLOBAL_NAME_PREFIX>") {
+		t.Fatalf("position of key is not reported: %s", msg)
+	}
+}
+
+func TestWorkReportRequireFailed(t *testing.T) {
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/demo/box.gp":  tstGpBox + "//#GOGP_REQUIRE(nosuch)\n",
+		"/app/demo/box.gpg": tstGpgBox,
+	})
+	r, err := NewRunner(Config{Silence: true, FS: fsys, Steps: []Step{StepProduce}}).Work("/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pe *ProcessError
+	if failed := r.Failed(); len(failed) != 2 || len(r.Entries) != 3 || !errors.As(failed[0].Err, &pe) ||
+		pe.Gp != "/app/demo/nosuch.gp" || pe.Target != "/app/demo/box.gp_int.go" || r.Entries[2].Status != StatusDone || r.Entries[2].Section != "" {
+		t.Fatalf("unexpected entries: %v", r.Entries)
+	}
+	if _, err := fsys.Stat("/app/demo/box.gp_int.go"); err == nil {
+		t.Fatal("product should not be written if #GOGP_REQUIRE(...) fails")
+	}
+}
+
+func TestRunnerOnceEveryRun(t *testing.T) {
+	src := testGoPath(t, map[string]string{
+		"demo/box.gp":  tstGpBox + "\n//#GOGP_ONCE\nconst boxOnce = 1\n//#GOGP_END_ONCE\n",
+		"demo/box.gpg": tstGpgBox,
+	})
+	r := NewRunner(Config{Silence: true, ForceUpdate: true})
+	for i := 0; i < 2; i++ {
+		rpt, err := r.Work("demo")
+		if err != nil || rpt.Err() != nil {
+			t.Fatal(err, rpt.Err())
+		}
+		n := 0
+		for _, f := range []string{"demo/box.gp_int.go", "demo/box.gp_string.go"} {
+			if strings.Contains(testReadFile(t, src+f), "const boxOnce = 1") {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Fatalf("run %d: #GOGP_ONCE code generated %d times", i+1, n)
+		}
+	}
+}
+
+func TestRunnerConfig(t *testing.T) {
+	src := testGoPath(t, map[string]string{
+		"demo/box.gp":  tstGpBox,
+		"demo/box.gpg": tstGpgBox,
+	})
+	if _, err := NewRunner(Config{Silence: true, CodeExt: ".txt"}).Work("demo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRunner(Config{Silence: true}).Work("demo"); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"demo/box.gp_int.txt", "demo/box.gp_int.go"} {
+		if _, err := os.Stat(src + f); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRunnerParallel(t *testing.T) {
+	files := map[string]string{}
+	for _, d := range []string{"a", "b", "c", "d", "e"} {
+		files["demo/"+d+"/box.gp"] = tstGpBox + "\n//#GOGP_ONCE\nconst boxOnce = 1\n//#GOGP_END_ONCE\n"
+		files["demo/"+d+"/box.gpg"] = tstGpgBox
+		files["demo/"+d+"/box2.gpg"] = "[box_int64]\nGOGP_GpFilePath=box\nPACKAGE=package demo\nVALUE_TYPE=int64\nGLOBAL_NAME_PREFIX=Int64\n"
+	}
+	src := testGoPath(t, files)
+
+	serial, err := NewRunner(Config{Silence: true, ForceUpdate: true}).Work("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallel, err := NewRunner(Config{Silence: true, ForceUpdate: true, Jobs: 4}).Work("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serial.Entries) != 40 || len(parallel.Entries) != len(serial.Entries) {
+		t.Fatalf("entries: serial=%d parallel=%d", len(serial.Entries), len(parallel.Entries))
+	}
+	for i := range serial.Entries {
+		if s, p := serial.Entries[i].String(), parallel.Entries[i].String(); s != p {
+			t.Errorf("entry %d: serial=[%s] parallel=[%s]", i, s, p)
+		}
+	}
+
+	//the first section in order of declaration owns #GOGP_ONCE block
+	for _, d := range []string{"a", "b", "c", "d", "e"} {
+		if code := testReadFile(t, src+"demo/"+d+"/box.gp_int.go"); !strings.Contains(code, "boxOnce") {
+			t.Errorf("%s: once block should be in box.gp_int.go:\n%s", d, code)
+		}
+	}
+}
+
+func TestRunnerParallelSharedGp(t *testing.T) {
+	files := map[string]string{"demo/tpl/box.gp": tstGpBox + "\n//#GOGP_ONCE\nconst boxOnce = 1\n//#GOGP_END_ONCE\n"}
+	dirs := []string{"a", "b", "c", "d", "e"}
+	for _, d := range dirs {
+		files["demo/"+d+"/box.gpg"] = strings.Replace(tstGpgBox, "GOGP_GpFilePath=box", "GOGP_GpFilePath=../tpl/box", -1)
+	}
+	src := testGoPath(t, files)
+
+	var codes [2][]string
+	for i, jobs := range []int{1, 4} {
+		r, err := NewRunner(Config{Silence: true, ForceUpdate: true, Jobs: jobs}).Work("demo")
+		if err == nil {
+			err = r.Err()
+		}
+		if err != nil || r.Count(StatusWritten) != 2*len(dirs) {
+			t.Fatalf("jobs=%d err=%v entries=%v", jobs, err, r.Entries)
+		}
+		for _, d := range dirs {
+			code := testReadFile(t, src+"demo/"+d+"/box.gp_int.go")
+			if !strings.Contains(code, "boxOnce") { //#GOGP_ONCE is recorded per directory
+				t.Errorf("jobs=%d %s: once block should be in box.gp_int.go:\n%s", jobs, d, code)
+			}
+			codes[i] = append(codes[i], code, testReadFile(t, src+"demo/"+d+"/box.gp_string.go"))
+		}
+	}
+	if !reflect.DeepEqual(codes[0], codes[1]) {
+		t.Fatal("products of parallel mode differ from serial mode")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	src := testGoPath(t, map[string]string{
+		"demo/box.gp":  tstGpBox,
+		"demo/box.gpg": tstGpgBox,
+	})
+	runner := NewRunner(Config{Silence: true})
+
+	r, err := runner.Check("demo")
+	if !errors.Is(err, ErrStale) || len(r.Changes) != 2 || r.Changes[0].Kind != ChangeCreate {
+		t.Fatalf("err=%v changes=%v", err, r.Changes)
+	}
+	if _, err := os.Stat(src + "demo/box.gp_int.go"); !os.IsNotExist(err) {
+		t.Fatalf("check mode should not write products: %v", err)
+	}
+
+	if _, err = runner.Work("demo"); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = runner.Check("demo"); err != nil || len(r.Changes) != 0 {
+		t.Fatalf("err=%v changes=%v", err, r.Changes)
+	}
+
+	testWriteFile(t, src+"demo/box.gpg", strings.Replace(tstGpgBox, "GLOBAL_NAME_PREFIX=String", "GLOBAL_NAME_PREFIX=Str", 1))
+	r, err = runner.Check("demo")
+	if !errors.Is(err, ErrStale) || len(r.Changes) != 1 || r.Changes[0].Kind != ChangeModify {
+		t.Fatalf("err=%v changes=%v", err, r.Changes)
+	}
+
+	r, err = NewRunner(Config{Silence: true, RemoveProductsOnly: true}).Check("demo")
+	if !errors.Is(err, ErrStale) || len(r.Changes) != 2 || r.Changes[1].Kind != ChangeRemove {
+		t.Fatalf("err=%v changes=%v", err, r.Changes)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	src := testGoPath(t, map[string]string{
+		"demo/box.gp":  tstGpBox,
+		"demo/box.gpg": tstGpgBox,
+	})
+	runner := NewRunner(Config{Silence: true, DryRun: true})
+
+	r, err := runner.Work("demo")
+	if err != nil || len(r.Changes) != 2 {
+		t.Fatalf("err=%v changes=%v", err, r.Changes)
+	}
+	if _, err := os.Stat(src + "demo/box.gp_int.go"); !os.IsNotExist(err) {
+		t.Fatalf("dry-run mode should not write products: %v", err)
+	}
+	var b strings.Builder
+	r.RenderDiff(&b)
+	if d := b.String(); !strings.Contains(d, "--- /dev/null\n+++ b/demo/box.gp_int.go\n") ||
+		!strings.Contains(d, "+func (b *IntBox) Get() int {\n") {
+		t.Fatalf("unexpected diff:\n%s", d)
+	}
+}
+
+func TestWorkOnMemFileSystem(t *testing.T) {
+	testSetenv(t, "GO111MODULE", "")
+	testSetenv(t, "GOWORK", "")
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/go.mod":       "module example.com/app\n",
+		"/app/tpl/box.gp":   tstGpBox,
+		"/app/demo/box.gpg": strings.Replace(tstGpgBox, "GOGP_GpFilePath=box", "GOGP_GpFilePath=example.com/app/tpl/box", -1),
+	})
+
+	r, err := NewRunner(Config{Silence: true, FS: fsys}).Work("/app")
+	if err == nil {
+		err = r.Err()
+	}
+	if err != nil || r.Count(StatusWritten) != 2 {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+	b, err := fsys.ReadFile("/app/demo/box.gp_string.go")
+	if err != nil || !strings.Contains(string(b), "func (b *StringBox) Get() string {") {
+		t.Fatalf("err=%v code:\n%s", err, b)
+	}
+	if _, err := os.Stat("/app/demo/box.gp_string.go"); !os.IsNotExist(err) {
+		t.Fatalf("products should be in memory only: %v", err)
+	}
+
+	r, err = NewRunner(Config{Silence: true, FS: fsys}).Check("/app")
+	if err != nil || len(r.Changes) != 0 {
+		t.Fatalf("err=%v changes=%v", err, r.Changes)
+	}
+
+	r, err = NewRunner(Config{Silence: true, FS: fsys, Excludes: []string{"demo/"}}).Work("/app")
+	if err != nil || len(r.Gpgs) != 0 {
+		t.Fatalf("err=%v gpgs=%v", err, r.Gpgs)
+	}
+}
+
+func TestRunnerSteps(t *testing.T) {
+	src := testGoPath(t, map[string]string{
+		"demo/box.gp":  tstGpBox,
+		"demo/box.gpg": tstGpgBox,
+	})
+
+	r, err := NewRunner(Config{Silence: true, Steps: []Step{StepReverse, StepRequire}}).Work("demo")
+	if err != nil || len(r.Entries) != 0 {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+	if _, err := os.Stat(src + "demo/box.gp_int.go"); !os.IsNotExist(err) {
+		t.Fatalf("produce step should not run: %v", err)
+	}
+
+	r, err = NewRunner(Config{Silence: true, Steps: []Step{StepProduce}}).Work("demo")
+	if err != nil || r.Count(StatusWritten) != 2 {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+}
+
+func TestWorkSection(t *testing.T) {
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/demo/box.gp":  tstGpBox,
+		"/app/demo/box.gpg": tstGpgBox,
+	})
+	runner := NewRunner(Config{Silence: true, FS: fsys})
+
+	r, err := runner.Work("/app/demo/box.gpg:box_string")
+	if err != nil || r.Err() != nil || r.Count(StatusWritten) != 1 {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+	if _, err := fsys.Stat("/app/demo/box.gp_int.go"); err == nil {
+		t.Fatal("box_int should not be processed")
+	}
+
+	r, err = runner.WorkFile("/app/demo/box.gpg")
+	if err != nil || r.Count(StatusWritten) != 1 || r.Count(StatusSkipped) != 1 {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+
+	if _, err = runner.WorkSection("/app/demo/box.gpg", "box_bool"); !errors.Is(err, ErrMissingSection) {
+		t.Fatalf("expect ErrMissingSection, got %v", err)
+	}
+	if _, err = runner.WorkFile("/app/demo/none.gpg"); !os.IsNotExist(err) {
+		t.Fatalf("expect not exist, got %v", err)
+	}
+}
+
+func TestSectionDeps(t *testing.T) {
+	ext := "//#GOGP_IGNORE_BEGIN\n" + txtGeneratedMark + "\n" +
+		provenanceLine("/app/other/ext.gp", "/app/other/ext.go", "/app/other/other.gpg", "GOGP_REVERSE_ext") + "\n" +
+		fmt.Sprintf(txtChecksumFmt, "") + txtHeadBar + "\n//#GOGP_IGNORE_END\n"
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/demo/use.gp":     "//#GOGP_REQUIRE(list)\n//#GOGP_REQUIRE(../other/ext)\n",
+		"/app/demo/list.gp.go": "//#GOGP_REQUIRE(node, #node_int)\n",
+		"/app/demo/demo.gpg": `[use_int]
+GOGP_GpFilePath=use
+
+[node_int]
+GOGP_GpFilePath=node
+
+[GOGP_REVERSE_list]
+GOGP_GpFilePath=list
+
+[GOGP_REVERSE_other]
+GOGP_GpFilePath=other
+`,
+		"/app/demo/reverse.gpg": "[GOGP_REVERSE_node]\nGOGP_GpFilePath=node\n",
+		"/app/demo/unused.gpg":  "[GOGP_REVERSE_unused]\nGOGP_GpFilePath=unused\n",
+		"/app/other/ext.gp":     ext,
+		"/app/other/other.gpg":  "[GOGP_REVERSE_ext]\nGOGP_GpFilePath=ext\n",
+	})
+	runner := NewRunner(Config{Silence: true, FS: fsys})
+	runner.reset()
+	deps, gpgs, err := runner.sectionDeps("/app/demo/demo.gpg", "use_int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]bool{
+		"/app/demo/demo.gpg:use_int":              true,
+		"/app/demo/demo.gpg:GOGP_REVERSE_list":    true,
+		"/app/demo/reverse.gpg:GOGP_REVERSE_node": true,
+		"/app/other/other.gpg:GOGP_REVERSE_ext":   true,
+	}
+	if !reflect.DeepEqual(deps, expect) {
+		t.Fatalf("deps=%v expect=%v", deps, expect)
+	}
+	if want := []string{"/app/demo/demo.gpg", "/app/demo/reverse.gpg", "/app/other/other.gpg"}; !reflect.DeepEqual(gpgs, want) {
+		t.Fatalf("gpgs=%v expect=%v", gpgs, want)
+	}
+
+	//section that generates a gp file in use is gone
+	fsys.WriteFile("/app/other/other.gpg", []byte("[GOGP_REVERSE_ext2]\nGOGP_GpFilePath=ext\n"))
+	if _, _, err = runner.sectionDeps("/app/demo/demo.gpg", "use_int"); !errors.Is(err, ErrMissingSection) {
+		t.Fatalf("expect ErrMissingSection, got %v", err)
+	}
+	if _, err = runner.WorkSection("/app/demo/demo.gpg", "use_int"); !errors.Is(err, ErrMissingSection) {
+		t.Fatalf("expect ErrMissingSection, got %v", err)
+	}
+}
+
+func TestSplitTarget(t *testing.T) {
+	cases := []struct {
+		target, gpg, section string
+		ok                   bool
+	}{
+		{"examples/example.gpg", "examples/example.gpg", "", true},
+		{"examples/example.gpg:list_int", "examples/example.gpg", "list_int", true},
+		{`C:\gopath\src\example.gpg:list_int`, `C:\gopath\src\example.gpg`, "list_int", true},
+		{"examples", "", "", false},
+		{"gopath", "", "", false},
+	}
+	for _, c := range cases {
+		if gpg, section, ok := splitTarget(c.target); gpg != c.gpg || section != c.section || ok != c.ok {
+			t.Errorf("%s: got %q %q %v", c.target, gpg, section, ok)
+		}
+	}
+}
+
+func TestReproducibleHeader(t *testing.T) {
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/demo/box.gp":  tstGpBox,
+		"/app/demo/box.gpg": tstGpgBox,
+	})
+	work := func(force bool) string {
+		r, err := NewRunner(Config{Silence: true, FS: fsys, ForceUpdate: force}).Work("/app")
+		if err == nil {
+			err = r.Err()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := fsys.ReadFile("/app/demo/box.gp_int.go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	code := work(false)
+	if !regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`).MatchString(code) {
+		t.Fatalf("missing generated mark:\n%s", code)
+	}
+	if !strings.HasPrefix(code, txtGeneratedMark+"\n") {
+		t.Fatalf("generated mark should be the first line:\n%s", code)
+	}
+	fp := regexp.MustCompile(`// Fingerprint: \[gp=[0-9a-f]{16} gpg=[0-9a-f]{16} version=` + regexp.QuoteMeta(libVersion) + `\]`).FindString(code)
+	if fp == "" {
+		t.Fatalf("missing fingerprint:\n%s", code)
+	}
+	if again := work(true); again != code {
+		t.Fatalf("output is not reproducible:\n%s\n%s", code, again)
+	}
+
+	//fingerprint changes with gpg section, even if body does not change
+	fsys.WriteFile("/app/demo/box.gpg", []byte(strings.Replace(tstGpgBox, "[box_int]\n", "[box_int]\nUNUSED=1\n", 1)))
+	if code = work(false); strings.Contains(code, fp) {
+		t.Fatalf("fingerprint should change:\n%s", code)
+	}
+}
+
+// failFS fails writing file bad
+type failFS struct {
+	*MemFileSystem
+	bad string
+}
+
+func (f failFS) WriteFile(name string, data []byte) error {
+	if name == f.bad {
+		return os.ErrPermission
+	}
+	return f.MemFileSystem.WriteFile(name, data)
+}
+
+func TestTransactional(t *testing.T) {
+	const old = "package demo\n//old\n"
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/demo/box.gp":        tstGpBox,
+		"/app/demo/box.gpg":       tstGpgBox + "\n[box_bad]\nGOGP_GpFilePath=box\nPACKAGE=package demo\nVALUE_TYPE=bool\n",
+		"/app/demo/box.gp_int.go": old,
+	})
+	cfg := Config{Silence: true, FS: fsys, Transactional: true, NoCache: true}
+
+	//a section fails, nothing is written
+	r, err := NewRunner(cfg).Work("/app")
+	if err != nil || !errors.Is(r.Err(), ErrNoReplacing) || !r.RolledBack || r.Count(StatusWritten) != 2 {
+		t.Fatalf("err=%v rolledBack=%v entries=%v", err, r.RolledBack, r.Entries)
+	}
+	if !strings.Contains(r.Summary(), "rolled back") {
+		t.Fatalf("summary: %s", r.Summary())
+	}
+	if b, _ := fsys.ReadFile("/app/demo/box.gp_int.go"); string(b) != old {
+		t.Fatalf("product should not be changed:\n%s", b)
+	}
+	if _, err := fsys.Stat("/app/demo/box.gp_string.go"); err == nil {
+		t.Fatal("product should not be created")
+	}
+
+	//commit fails halfway, written files are restored
+	fsys.WriteFile("/app/demo/box.gpg", []byte(tstGpgBox))
+	cfg.FS = failFS{fsys, "/app/demo/box.gp_string.go"}
+	if r, err = NewRunner(cfg).Work("/app"); err != nil || !errors.Is(r.Err(), os.ErrPermission) || !errors.Is(r.Err(), ErrSaveFile) || !r.RolledBack {
+		t.Fatalf("err=%v rolledBack=%v entries=%v", err, r.RolledBack, r.Entries)
+	}
+	if b, _ := fsys.ReadFile("/app/demo/box.gp_int.go"); string(b) != old {
+		t.Fatalf("product should be restored:\n%s", b)
+	}
+
+	//everything succeeds, all is committed
+	cfg.FS = fsys
+	if r, err = NewRunner(cfg).Work("/app"); err != nil || r.Err() != nil || r.RolledBack || r.InMemory || r.Count(StatusWritten) != 2 {
+		t.Fatalf("err=%v rolledBack=%v entries=%v", err, r.RolledBack, r.Entries)
+	}
+	if b, _ := fsys.ReadFile("/app/demo/box.gp_string.go"); !strings.Contains(string(b), "func (b *StringBox) Get() string {") {
+		t.Fatalf("product should be written:\n%s", b)
+	}
+}
+
+func TestModifiedProduct(t *testing.T) {
+	const product = "/app/demo/box.gp_int.go"
+	fsys := NewMemFileSystem(map[string]string{
+		"/app/demo/box.gp":  tstGpBox,
+		"/app/demo/box.gpg": tstGpgBox,
+	})
+	cfg := Config{Silence: true, FS: fsys, NoCache: true}
+	if r, err := NewRunner(cfg).Work("/app"); err != nil || r.Err() != nil {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+	b, _ := fsys.ReadFile(product)
+	if isModified(string(b)) || !strings.Contains(string(b), "// Checksum: [body="+contentHash(string(b[strings.Index(string(b), "\n\npackage")+1:]))+"]\n") {
+		t.Fatalf("bad checksum:\n%s", b)
+	}
+
+	//body modified by hand, refuse to overwrite or remove it
+	edited := strings.Replace(string(b), "func (b *IntBox) Get() int {", "func (b *IntBox) Get() int { //edited", 1)
+	fsys.WriteFile(product, []byte(edited))
+	if !isModified(edited) {
+		t.Fatal("product should be modified")
+	}
+	for _, remove := range []bool{false, true} {
+		cfg.RemoveProductsOnly = remove
+		r, err := NewRunner(cfg).Work("/app")
+		var pe *ProcessError
+		if err != nil || !errors.As(r.Err(), &pe) || !errors.Is(pe, ErrModified) ||
+			pe.Section != "box_int" || !strings.HasSuffix(pe.Gpg, "box.gpg") || !strings.HasSuffix(pe.Gp, "box.gp") {
+			t.Fatalf("remove=%v err=%v entries=%v", remove, err, r.Entries)
+		}
+		if b, _ := fsys.ReadFile(product); string(b) != edited {
+			t.Fatalf("remove=%v product should not be changed:\n%s", remove, b)
+		}
+	}
+
+	//render refuses it like a real run
+	cfg.RemoveProductsOnly = false
+	var out strings.Builder
+	if r, err := NewRunner(cfg).Render("/app", &out); err != nil || !errors.Is(r.Err(), ErrModified) || strings.Contains(out.String(), product) {
+		t.Fatalf("err=%v entries=%v render:\n%s", err, r.Entries, out.String())
+	}
+
+	//overwritten with ForceUpdate
+	cfg.ForceUpdate = true
+	if r, err := NewRunner(cfg).Work("/app"); err != nil || r.Err() != nil {
+		t.Fatalf("err=%v entries=%v", err, r.Entries)
+	}
+	if b2, _ := fsys.ReadFile(product); string(b2) != string(b) {
+		t.Fatalf("product should be restored:\n%s", b2)
+	}
+}
+
+func TestLintAndRender(t *testing.T) {
+	src := testGoPath(t, map[string]string{
+		"demo/box.gp":  tstGpBox,
+		"demo/box.gpg": tstGpgBox,
+	})
+	runner := NewRunner(Config{Silence: true})
+
+	if r, err := runner.Lint("demo"); err != nil || len(r.Changes) != 0 {
+		t.Fatalf("err=%v changes=%v", err, r.Changes)
+	}
+
+	var b strings.Builder
+	if _, err := runner.Render("demo", &b); err != nil {
+		t.Fatal(err)
+	}
+	if out := b.String(); !strings.Contains(out, "//==== demo/box.gp_int.go ====\n") ||
+		!strings.Contains(out, "func (b *StringBox) Get() string {") {
+		t.Fatalf("unexpected render:\n%s", out)
+	}
+	if _, err := os.Stat(src + "demo/box.gp_int.go"); !os.IsNotExist(err) {
+		t.Fatalf("render should not write products: %v", err)
+	}
+
+	testWriteFile(t, src+"demo/box.gpg", strings.Replace(tstGpgBox, "GLOBAL_NAME_PREFIX=String\n", "", 1))
+	if _, err := runner.Lint("demo"); !errors.Is(err, ErrNoReplacing) {
+		t.Fatalf("expect ErrNoReplacing, got %v", err)
+	}
+}